@@ -1,18 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/baseline"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/cache"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/git"
 )
 
 // Unix: 128 + signal number (SIGINT = 2).
@@ -38,6 +48,56 @@ var (
 	verbose     = flag.Bool("v", false, "verbose output")
 	showVersion = flag.Bool("version", false, "show version information")
 	parallelism = flag.Int("parallelism", 0, "number of files to process in parallel (0 = NumCPU)")
+	filesFrom   = flag.String("files-from", "", "read file names to process from file (- for stdin), one per line")
+	nulSep      = flag.Bool("0", false, "file names read by -files-from are separated by NUL instead of newline")
+	cacheMode   = flag.String("cache", cacheOn, "skip files known to be formatted by previous runs: on or off, or clean to remove the cache and exit")
+	markdown    = flag.Bool("markdown", false, "also format Go code blocks of Markdown files found in directories, by -diff-base and -staged")
+	staged      = flag.Bool("staged", false, "format the Go files staged in the git index, for pre-commit hooks")
+	diffBase    = flag.String("diff-base", "", "only format lines added or modified relative to the merge base with this git ref")
+	lines       = lineRangesFlag("lines", "format only statements within START:END lines (repeatable), for a single file or stdin")
+
+	baselineFile   = flag.String("baseline", "", "suppress violations recorded in file, check runs fail only on new ones")
+	updateBaseline = flag.Bool("update-baseline", false, "record the current violations in the -baseline file")
+)
+
+// Rule flags.
+var (
+	ruleNames = flag.String("rules", bytefmt.NLReturnName,
+		"comma separated rules to apply, in order of precedence: "+strings.Join(bytefmt.RuleNames(), ", "))
+	blockMeasure = flag.String("block-measure", bytefmt.MeasureLines.String(),
+		"measure block size in lines or statements")
+	shortFunc = flag.Int("short-func", 0,
+		"leave functions whose body spans at most n lines or statements (see -block-measure) alone (0 = off)")
+	funcLitBlockSize = flag.Int("func-lit-block-size", -1,
+		"block size for statements inside function literals (-1 = same as -block-size)")
+	skipFuncLit = flag.Bool("skip-func-lit", false,
+		"do not require blank lines before statements inside function literals")
+	kinds = flag.String("kinds", "return,break,continue,goto,fallthrough",
+		"comma separated statements that require a blank line before them")
+	strict = flag.Bool("strict", false,
+		"also remove blank lines that are not required and collapse multiple blank lines into one")
+	cuddleAssign = flag.Int("cuddle-assign", 0,
+		"allow a return to stay cuddled with a preceding assignment of at most n lines it uses (0 = off)")
+	caseSep = flag.String("case-sep", caseSepEnforce,
+		"case-sep rule: enforce or forbid a blank line between case clauses")
+	caseSepMinLines = flag.Int("case-sep-min-lines", 2, //nolint: mnd // Multi-line clauses.
+		"case-sep rule: check only clauses following a clause of at least n lines")
+	maxBlank = flag.Int("max-blank", 1,
+		"max-blank rule: maximum number of consecutive blank lines inside function bodies")
+	terminating = flag.Bool("terminating-calls", false,
+		"also require a blank line before calls that never return: "+strings.Join(bytefmt.DefaultTerminatingCalls(), ", "))
+	terminatingFuncs = flag.String("terminating-funcs", "",
+		"comma separated qualified names (or patterns) of additional calls that never return, e.g. mylog.Die; "+
+			"implies -terminating-calls")
+)
+
+const (
+	cacheOn    = "on"
+	cacheOff   = "off"
+	cacheClean = "clean"
+
+	caseSepEnforce = "enforce"
+	caseSepForbid  = "forbid"
 )
 
 func main() {
@@ -52,10 +112,76 @@ func main() {
 	}
 }
 
+// lineRanges is a repeatable flag of START:END line ranges.
+type lineRanges []bytefmt.LineRange
+
+// lineRangesFlag defines a lineRanges flag, like flag.String does for strings.
+func lineRangesFlag(name, usage string) *lineRanges {
+	r := new(lineRanges)
+	flag.Var(r, name, usage)
+
+	return r
+}
+
+func (r *lineRanges) String() string {
+	parts := make([]string, 0, len(*r))
+	for _, lr := range *r {
+		parts = append(parts, fmt.Sprintf("%d:%d", lr.Start, lr.End))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (r *lineRanges) Set(s string) error {
+	startStr, endStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("invalid line range %q, want START:END", s)
+	}
+
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return fmt.Errorf("invalid line range start %q: %w", startStr, err)
+	}
+	end, err := strconv.Atoi(endStr)
+	if err != nil {
+		return fmt.Errorf("invalid line range end %q: %w", endStr, err)
+	}
+	if start < 1 || end < start {
+		return fmt.Errorf("invalid line range %q", s)
+	}
+
+	*r = append(*r, bytefmt.LineRange{Start: start, End: end})
+
+	return nil
+}
+
+// checkLinesTarget ensures -lines applies to a single regular file or stdin.
+func checkLinesTarget() error {
+	switch {
+	case *diffBase != "":
+		return errors.New("-lines flag cannot be combined with -diff-base")
+	case flag.NArg() > 1 || *filesFrom != "":
+		return errors.New("-lines flag requires a single file or stdin")
+	case flag.NArg() == 0:
+		return nil
+	}
+
+	info, err := os.Stat(flag.Arg(0))
+	if err != nil {
+		return fmt.Errorf("os.Stat: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("-lines flag requires a single file or stdin")
+	}
+
+	return nil
+}
+
 func run() error {
 	//nolint: reassign
 	flag.Usage = func() {
 		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [flags] [path ...]", formatterName)
+		_, _ = fmt.Fprintf(os.Stderr, "\n       %s -cache=clean", formatterName)
 		_, _ = fmt.Fprintf(os.Stderr, "\n%s", formatterDoc)
 		_, _ = fmt.Fprintf(os.Stderr, "\nFlags:")
 		flag.PrintDefaults()
@@ -68,10 +194,30 @@ func run() error {
 		return nil
 	}
 
+	if *cacheMode == cacheClean {
+		return cleanCache()
+	}
+
+	rules, err := buildRules()
+	if err != nil {
+		return err
+	}
+
+	measure, err := bytefmt.ParseMeasure(*blockMeasure)
+	if err != nil {
+		return fmt.Errorf("-block-measure: %w", err)
+	}
+
 	opts := []nlreturnfmt.Option{
-		nlreturnfmt.WithBlockSize(*blockSize),
+		nlreturnfmt.WithRules(rules...),
+		nlreturnfmt.WithShortFuncs(*shortFunc, measure),
 		nlreturnfmt.WithParallelism(*parallelism),
 	}
+	cacheOpts, err := cacheOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, cacheOpts...)
 	if *write {
 		opts = append(opts, nlreturnfmt.WithWrite())
 	}
@@ -81,15 +227,169 @@ func run() error {
 	if *verbose {
 		opts = append(opts, nlreturnfmt.WithVerbose())
 	}
-	formatter := nlreturnfmt.New(opts...)
+	if *markdown {
+		opts = append(opts, nlreturnfmt.WithMarkdown())
+	}
+	if len(*lines) != 0 {
+		if err = checkLinesTarget(); err != nil {
+			return err
+		}
+		opts = append(opts, nlreturnfmt.WithLineRanges(*lines...))
+	}
+
+	if *staged && (flag.NArg() != 0 || *filesFrom != "" || *diffBase != "" || len(*lines) != 0) {
+		return errors.New("-staged flag cannot be combined with paths, -files-from, -diff-base or -lines")
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	return process(ctx, formatter)
+	var changed []string
+	if *diffBase != "" {
+		changes, err := git.Diff(ctx, ".", *diffBase)
+		if err != nil {
+			return fmt.Errorf("-diff-base: %w", err)
+		}
+		opts = append(opts, nlreturnfmt.WithFileLineRanges(changes.Ranges))
+		changed = changedFiles(changes)
+	}
+	baselineOpts, record, err := baselineOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, baselineOpts...)
+	formatter := nlreturnfmt.New(opts...)
+
+	if err = process(ctx, formatter, changed); err != nil {
+		return err
+	}
+
+	return finishBaseline(formatter, record)
+}
+
+// baselineOptions loads the -baseline file, or returns the baseline to record
+// violations in with -update-baseline.
+func baselineOptions() ([]nlreturnfmt.Option, *baseline.Baseline, error) {
+	switch {
+	case *baselineFile == "" && *updateBaseline:
+		return nil, nil, errors.New("-update-baseline flag requires -baseline")
+	case *baselineFile == "":
+		return nil, nil, nil
+	case *updateBaseline:
+		if *staged || flag.NArg() == 0 && *filesFrom == "" && *diffBase == "" {
+			return nil, nil, errors.New("-update-baseline flag requires paths, -files-from or -diff-base")
+		}
+		record := baseline.New(baselineRoot())
+
+		return []nlreturnfmt.Option{nlreturnfmt.WithBaselineUpdate(record)}, record, nil
+	}
+
+	b, err := baseline.Load(*baselineFile, baselineRoot())
+	if err != nil {
+		return nil, nil, fmt.Errorf("-baseline: %w", err)
+	}
+
+	return []nlreturnfmt.Option{nlreturnfmt.WithBaseline(b)}, nil, nil
+}
+
+// baselineRoot returns the module or repository root of the -baseline file,
+// which file names in the baseline are relative to.
+func baselineRoot() string {
+	return baseline.FindRoot(filepath.Dir(*baselineFile))
+}
+
+// finishBaseline saves the recorded baseline, or fails a check run that
+// found violations not in the baseline.
+func finishBaseline(formatter *nlreturnfmt.Formatter, record *baseline.Baseline) error {
+	switch {
+	case record != nil:
+		if err := record.Save(*baselineFile); err != nil {
+			return fmt.Errorf("baseline.Save: %w", err)
+		}
+	case *baselineFile != "" && (!*write || *dryRun):
+		if n := formatter.ModifiedFiles(); n > 0 {
+			return fmt.Errorf("%d files have violations not in the baseline", n)
+		}
+	}
+
+	return nil
+}
+
+// changedFiles returns the changed files to be formatted when -diff-base is
+// given no paths.
+func changedFiles(changes git.Changes) []string {
+	wd := workDir()
+
+	var files []string
+	for _, file := range changes.Files() {
+		if formattable(file) {
+			files = append(files, relPath(wd, file))
+		}
+	}
+
+	return files
+}
+
+// formattable reports whether a file found by git is formatted: Go files and,
+// with -markdown, Markdown files.
+func formattable(name string) bool {
+	return strings.HasSuffix(name, ".go") || *markdown && strings.HasSuffix(name, ".md")
+}
+
+// workDir returns the working directory with symlinks resolved, as in the
+// paths reported by git, or an empty string if it is unknown.
+func workDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = resolved
+	}
+
+	return wd
+}
+
+// relPath returns file relative to wd where possible, for shorter output.
+func relPath(wd, file string) string {
+	if wd == "" {
+		return file
+	}
+	if rel, err := filepath.Rel(wd, file); err == nil {
+		return rel
+	}
+
+	return file
 }
 
-func process(ctx context.Context, formatter *nlreturnfmt.Formatter) error {
+func process(ctx context.Context, formatter *nlreturnfmt.Formatter, changed []string) error {
+	if *staged {
+		if err := processStaged(ctx, formatter); err != nil {
+			return fmt.Errorf("processStaged: %w", err)
+		}
+
+		return nil
+	}
+
+	if *diffBase != "" && flag.NArg() == 0 && *filesFrom == "" {
+		if err := formatter.FormatFiles(ctx, slices.Values(changed)); err != nil {
+			return fmt.Errorf("formatter.FormatFiles: %w", err)
+		}
+
+		return nil
+	}
+
+	if *filesFrom != "" {
+		if flag.NArg() != 0 {
+			return errors.New("-files-from flag cannot be combined with path arguments")
+		}
+		if err := processFilesFrom(ctx, formatter, *filesFrom); err != nil {
+			return fmt.Errorf("processFilesFrom: %w", err)
+		}
+
+		return nil
+	}
+
 	if flag.NArg() == 0 {
 		if *write {
 			return errors.New("-w flag is not supported when processing from stdin")
@@ -106,15 +406,93 @@ func process(ctx context.Context, formatter *nlreturnfmt.Formatter) error {
 	return nil
 }
 
+func buildRules() ([]bytefmt.Rule, error) {
+	var rules []bytefmt.Rule
+	for name := range strings.SplitSeq(*ruleNames, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		rule, err := bytefmt.NewRule(name)
+		if err != nil {
+			return nil, fmt.Errorf("-rules: %w", err)
+		}
+		if err = configureRule(rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil, errors.New("-rules: no rules to apply")
+	}
+
+	return rules, nil
+}
+
+// configureRule applies the flags of a rule.
+func configureRule(rule bytefmt.Rule) error {
+	measure, err := bytefmt.ParseMeasure(*blockMeasure)
+	if err != nil {
+		return fmt.Errorf("-block-measure: %w", err)
+	}
+
+	switch r := rule.(type) {
+	case *bytefmt.NLReturn:
+		if *blockSize >= 0 {
+			r.BlockSize = *blockSize
+		}
+		r.Measure = measure
+		r.FuncLit = bytefmt.Scope{Disabled: *skipFuncLit}
+		if *funcLitBlockSize >= 0 {
+			r.FuncLit.BlockSize = funcLitBlockSize
+		}
+		r.Strict = *strict
+		r.CuddleAssign = *cuddleAssign
+
+		if r.Kinds, err = bytefmt.ParseKinds(*kinds); err != nil {
+			return fmt.Errorf("-kinds: %w", err)
+		}
+
+		// Additional terminating calls imply -terminating-calls.
+		if *terminating || *terminatingFuncs != "" {
+			r.TerminatingCalls = bytefmt.DefaultTerminatingCalls()
+			for name := range strings.SplitSeq(*terminatingFuncs, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					r.TerminatingCalls = append(r.TerminatingCalls, name)
+				}
+			}
+		}
+	case *bytefmt.DeferGo:
+		if *blockSize >= 0 {
+			r.BlockSize = *blockSize
+		}
+		r.Measure = measure
+	case *bytefmt.CaseSep:
+		switch *caseSep {
+		case caseSepEnforce:
+		case caseSepForbid:
+			r.Forbid = true
+		default:
+			return fmt.Errorf("-case-sep: unknown value %q, want %s or %s", *caseSep, caseSepEnforce, caseSepForbid)
+		}
+		r.MinLines = *caseSepMinLines
+	case *bytefmt.MaxBlank:
+		r.Max = *maxBlank
+	}
+
+	return nil
+}
+
 func processSource(ctx context.Context, formatter *nlreturnfmt.Formatter) error {
 	src, err := io.ReadAll(os.Stdin)
 	if err != nil {
 		return fmt.Errorf("io.ReadAll: %w", err)
 	}
 
-	result, modified, err := formatter.FormatFile(ctx, "<stdin>", src)
+	result, modified, err := formatter.FormatFragment(ctx, "<stdin>", src)
 	if err != nil {
-		return fmt.Errorf("formatter.FormatFile: %w", err)
+		return fmt.Errorf("formatter.FormatFragment: %w", err)
 	}
 
 	if !modified {
@@ -130,16 +508,119 @@ func processSource(ctx context.Context, formatter *nlreturnfmt.Formatter) error
 }
 
 func processPaths(ctx context.Context, formatter *nlreturnfmt.Formatter, paths []string) error {
-	for _, path := range paths {
-		if err := formatter.FormatPath(ctx, path); err != nil {
-			return fmt.Errorf("formatter.FormatPath: %w", err)
+	if err := formatter.FormatPaths(ctx, paths...); err != nil {
+		return fmt.Errorf("formatter.FormatPaths: %w", err)
+	}
+
+	return nil
+}
+
+func processFilesFrom(ctx context.Context, formatter *nlreturnfmt.Formatter, name string) error {
+	r := os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("os.Open: %w", err)
 		}
+		defer func() { _ = file.Close() }()
+		r = file
+	}
+
+	scanner := bufio.NewScanner(r)
+	if *nulSep {
+		scanner.Split(scanNUL)
+	}
+
+	err := formatter.FormatFiles(ctx, scanFilenames(scanner))
+	if err != nil {
+		return fmt.Errorf("formatter.FormatFiles: %w", err)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("scanner.Err: %w", err)
 	}
 
 	return nil
 }
 
-func buildVersion() string {
+// scanFilenames yields non-empty tokens of scanner.
+func scanFilenames(scanner *bufio.Scanner) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for scanner.Scan() {
+			if name := scanner.Text(); name != "" && !yield(name) {
+				return
+			}
+		}
+	}
+}
+
+// scanNUL is a bufio.SplitFunc for NUL separated input (find -print0, git -z).
+func scanNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// cleanCache removes the cache of formatted files.
+func cleanCache() error {
+	if flag.NArg() != 0 {
+		return errors.New("-cache=clean does not take paths")
+	}
+
+	dir, err := cache.Dir()
+	if err != nil {
+		return fmt.Errorf("cache.Dir: %w", err)
+	}
+	if err = cache.New(dir, "").Clean(); err != nil {
+		return fmt.Errorf("cache.Clean: %w", err)
+	}
+
+	return nil
+}
+
+// cacheOptions returns no options when caching is disabled. Builds without a
+// release version are not cached, since their formatting rules may change
+// without notice.
+func cacheOptions() ([]nlreturnfmt.Option, error) {
+	switch *cacheMode {
+	case cacheOff:
+		return nil, nil
+	case cacheOn:
+	default:
+		return nil, fmt.Errorf("-cache: unknown value %q, want %s, %s or %s", *cacheMode, cacheOn, cacheOff, cacheClean)
+	}
+
+	if !cacheable(resolveVersion()) {
+		return nil, nil
+	}
+
+	// The cache is best effort, e.g. CI containers may have no home directory.
+	dir, err := cache.Dir()
+	if err != nil {
+		if *verbose {
+			_, _ = fmt.Fprintf(os.Stderr, "cache disabled: %v\n", err)
+		}
+
+		return nil, nil
+	}
+
+	return []nlreturnfmt.Option{nlreturnfmt.WithCache(dir, buildVersion())}, nil
+}
+
+// develVersion is reported by debug.ReadBuildInfo for builds without version information.
+const develVersion = "(devel)"
+
+// cacheable reports whether a build version identifies its rule code: builds
+// without version information or from a modified checkout (+dirty) do not.
+func cacheable(ver string) bool {
+	return ver != "" && ver != "dev" && ver != develVersion && !strings.HasSuffix(ver, "+dirty")
+}
+
+func resolveVersion() string {
 	ver := version
 	if ver == "dev" {
 		if info, ok := debug.ReadBuildInfo(); ok {
@@ -147,8 +628,12 @@ func buildVersion() string {
 		}
 	}
 
+	return ver
+}
+
+func buildVersion() string {
 	var b strings.Builder
-	b.WriteString(fmt.Sprintf("%s version %s", formatterName, ver))
+	b.WriteString(fmt.Sprintf("%s version %s", formatterName, resolveVersion()))
 
 	var details []string
 	if commit != "" {
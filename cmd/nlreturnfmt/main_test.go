@@ -25,6 +25,17 @@ func TestMain(m *testing.M) {
 	os.Exit(exitCode)
 }
 
+// command prepares a run of the binary. The cache of formatted files is kept
+// away from the user's cache dir.
+func command(t *testing.T, args ...string) *exec.Cmd {
+	t.Helper()
+
+	cmd := exec.Command(binaryPath, args...)
+	cmd.Env = append(os.Environ(), "XDG_CACHE_HOME="+t.TempDir(), "HOME="+t.TempDir())
+
+	return cmd
+}
+
 func TestCLI(t *testing.T) {
 	input := readFile(t, "../../testdata/p/p.input.go")
 	golden := readFile(t, "../../testdata/p/p.golden.go")
@@ -33,6 +44,7 @@ func TestCLI(t *testing.T) {
 		name         string
 		args         []string
 		stdin        string
+		pathInStdin  bool
 		setup        func(t *testing.T) (filePath string, teardown func())
 		wantExitCode int
 		wantStdout   string
@@ -67,6 +79,106 @@ func TestCLI(t *testing.T) {
 			wantExitCode: 0,
 			wantStdout:   "",
 		},
+		{
+			name: "format files listed on stdin with -files-from",
+			setup: func(t *testing.T) (string, func()) {
+				filePath := writeFile(t, "test.go", input)
+
+				return filePath, func() {
+					got := readFile(t, filePath)
+					require.Equal(t, string(golden), string(got))
+				}
+			},
+			args:         []string{"-w", "-files-from=-"},
+			stdin:        "\n<filepath>\n",
+			pathInStdin:  true,
+			wantExitCode: 0,
+		},
+		{
+			name: "format NUL separated files listed on stdin",
+			setup: func(t *testing.T) (string, func()) {
+				filePath := writeFile(t, "test.go", input)
+
+				return filePath, func() {
+					got := readFile(t, filePath)
+					require.Equal(t, string(golden), string(got))
+				}
+			},
+			args:         []string{"-w", "-files-from=-", "-0"},
+			stdin:        "<filepath>\x00",
+			pathInStdin:  true,
+			wantExitCode: 0,
+		},
+		{
+			name:         "format line range from stdin",
+			args:         []string{"-lines=3:4", "-lines=9:10"},
+			stdin:        "package p\n\nfunc a() {\n\tprintln()\n\treturn\n}\n\nfunc b() {\n\tprintln()\n\treturn\n}\n",
+			wantExitCode: 0,
+			wantStdout:   "func a() {\n\tprintln()\n\treturn\n}\n\nfunc b() {\n\tprintln()\n\n\treturn\n}\n",
+		},
+		{
+			name:         "format statement list fragment from stdin",
+			stdin:        "\tif err != nil {\n\t\tlog(err)\n\t\treturn err\n\t}",
+			wantExitCode: 0,
+			wantStdout:   "\tif err != nil {\n\t\tlog(err)\n\n\t\treturn err\n\t}",
+		},
+		{
+			name:         "-terminating-funcs implies -terminating-calls",
+			args:         []string{"-terminating-funcs=mylog.Die"},
+			stdin:        "package p\n\nfunc f() {\n\tprintln()\n\tmylog.Die()\n}\n\nfunc g() {\n\tprintln()\n\tpanic(1)\n}\n",
+			wantExitCode: 0,
+			wantStdout:   "\tprintln()\n\n\tmylog.Die()\n}\n\nfunc g() {\n\tprintln()\n\n\tpanic(1)\n}\n",
+		},
+		{
+			name:         "error on -lines with several files",
+			args:         []string{"-lines=1:2", "a.go", "b.go"},
+			wantExitCode: 1,
+			wantStderr:   "-lines flag requires a single file or stdin",
+		},
+		{
+			name: "error on -lines with a directory",
+			setup: func(t *testing.T) (string, func()) {
+				return t.TempDir(), nil
+			},
+			args:         []string{"-lines=1:2"},
+			wantExitCode: 1,
+			wantStderr:   "-lines flag requires a single file or stdin",
+		},
+		{
+			name:         "error on -lines with -diff-base",
+			args:         []string{"-lines=1:2", "-diff-base=main", "a.go"},
+			wantExitCode: 1,
+			wantStderr:   "-lines flag cannot be combined with -diff-base",
+		},
+		{
+			name:         "-cache=clean",
+			args:         []string{"-cache=clean"},
+			wantExitCode: 0,
+		},
+		{
+			name:         "error on -cache=clean with paths",
+			args:         []string{"-cache=clean", "file.go"},
+			wantExitCode: 1,
+			wantStderr:   "-cache=clean does not take paths",
+		},
+		{
+			name:         "error on unknown -cache value",
+			args:         []string{"-cache=maybe", "file.go"},
+			wantExitCode: 1,
+			wantStderr:   "-cache: unknown value",
+		},
+		{
+			name:         "error on unknown -kinds value",
+			args:         []string{"-kinds=return,defer", "file.go"},
+			wantExitCode: 1,
+			wantStderr:   `unknown statement kind "defer"`,
+		},
+		{
+			name:         "error on empty -kinds value",
+			args:         []string{"-kinds=", "file.go"},
+			wantExitCode: 1,
+			wantStderr:   "-kinds: no statement kinds given",
+		},
 		{
 			name:         "error on non-existent file",
 			args:         []string{"non_existent_file.go"},
@@ -87,12 +199,16 @@ func TestCLI(t *testing.T) {
 			}
 
 			args := tt.args
-			if filePath != "" {
+			stdin := tt.stdin
+			switch {
+			case tt.pathInStdin:
+				stdin = strings.ReplaceAll(stdin, "<filepath>", filePath)
+			case filePath != "":
 				args = append(args, filePath)
 			}
 
-			cmd := exec.Command(binaryPath, args...)
-			cmd.Stdin = strings.NewReader(tt.stdin)
+			cmd := command(t, args...)
+			cmd.Stdin = strings.NewReader(stdin)
 			var stdout, stderr bytes.Buffer
 			cmd.Stdout = &stdout
 			cmd.Stderr = &stderr
@@ -118,6 +234,173 @@ func TestCLI(t *testing.T) {
 	}
 }
 
+func TestCLI_CacheDirs(t *testing.T) {
+	input := readFile(t, "../../testdata/p/p.input.go")
+	golden := readFile(t, "../../testdata/p/p.golden.go")
+
+	// Directories named like the former "cache clean" subcommand are paths.
+	dir := t.TempDir()
+	for _, name := range []string{"cache", "clean"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, "p.go"), input, 0o600))
+	}
+
+	cmd := command(t, "-w", "cache", "clean")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	for _, name := range []string{"cache", "clean"} {
+		require.Equal(t, string(golden), string(readFile(t, filepath.Join(dir, name, "p.go"))))
+	}
+}
+
+func TestCLI_NoCacheDir(t *testing.T) {
+	input := readFile(t, "../../testdata/p/p.input.go")
+	golden := readFile(t, "../../testdata/p/p.golden.go")
+	file := writeFile(t, "test.go", input)
+
+	// Without a user cache directory formatting runs uncached.
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	for _, args := range [][]string{{"-w", file}, {}} {
+		cmd := exec.Command(binaryPath, args...)
+		cmd.Env = env
+		cmd.Stdin = bytes.NewReader(input)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	require.Equal(t, string(golden), string(readFile(t, file)))
+}
+
+func TestCacheable(t *testing.T) {
+	for ver, want := range map[string]bool{
+		"v1.2.3":                                   true,
+		"v0.0.0-20260101000000-abcdef123456":       true,
+		"v0.0.0-20260101000000-abcdef123456+dirty": false,
+		"(devel)": false,
+		"dev":     false,
+		"":        false,
+	} {
+		require.Equal(t, want, cacheable(ver), ver)
+	}
+}
+
+func TestCLI_Staged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	const (
+		unformatted = "package p\n\nfunc f() {\n\tprintln()\n\treturn\n}\n"
+		formatted   = "package p\n\nfunc f() {\n\tprintln()\n\n\treturn\n}\n"
+		unstaged    = "package p\n\nfunc f() {\n\tprintln(1)\n\treturn\n}\n"
+	)
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		dir := t.TempDir()
+		gitCmd(t, dir, "init", "-q")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package p\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), []byte("package p\n"), 0o644))
+		gitCmd(t, dir, "add", ".")
+		gitCmd(t, dir, "commit", "-q", "-m", "initial")
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte(unformatted), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), []byte(unformatted), 0o644))
+		gitCmd(t, dir, "add", ".")
+		// b.go is partially staged.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), []byte(unstaged), 0o644))
+
+		return dir
+	}
+	run := func(t *testing.T, dir string, args ...string) (string, error) {
+		t.Helper()
+
+		cmd := command(t, append([]string{"-staged"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+
+		return string(out), err
+	}
+
+	t.Run("check", func(t *testing.T) {
+		dir := setup(t)
+
+		out, err := run(t, dir)
+		require.Error(t, err)
+		require.Contains(t, out, "a.go: would be modified")
+		require.Contains(t, out, "b.go: would be modified")
+		require.Contains(t, out, "2 staged files are not formatted")
+		require.Equal(t, unformatted, gitCmd(t, dir, "show", ":a.go"))
+	})
+
+	t.Run("write", func(t *testing.T) {
+		dir := setup(t)
+
+		out, err := run(t, dir, "-w")
+		require.Error(t, err)
+		require.Contains(t, out, "b.go: not written, working tree differs from index")
+
+		require.Equal(t, formatted, gitCmd(t, dir, "show", ":a.go"))
+		require.Equal(t, formatted, string(readFile(t, filepath.Join(dir, "a.go"))))
+		require.Equal(t, unformatted, gitCmd(t, dir, "show", ":b.go"))
+		require.Equal(t, unstaged, string(readFile(t, filepath.Join(dir, "b.go"))))
+	})
+}
+
+func TestCLI_Baseline(t *testing.T) {
+	const (
+		legacy    = "package p\n\nfunc f() {\n\tprintln()\n\treturn\n}\n"
+		shifted   = "package p\n\nvar v int\n\nfunc f() {\n\tprintln()\n\treturn\n}\n"
+		violation = "\nfunc g() {\n\tprintln()\n\treturn\n}\n"
+	)
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module m\n"), 0o644))
+	file := filepath.Join(sub, "p.go")
+	run := func(wd string, args ...string) (string, error) {
+		cmd := command(t, args...)
+		cmd.Dir = wd
+		out, err := cmd.CombinedOutput()
+
+		return string(out), err
+	}
+
+	require.NoError(t, os.WriteFile(file, []byte(legacy), 0o644))
+	out, err := run(dir, "-n", "-baseline=baseline.json", "-update-baseline", "sub/p.go")
+	require.NoError(t, err, out)
+	require.FileExists(t, filepath.Join(dir, "baseline.json"))
+
+	// Paths are matched relative to the module root, wherever the tool runs.
+	require.NoError(t, os.WriteFile(file, []byte(shifted), 0o644))
+	out, err = run(sub, "-n", "-baseline=../baseline.json", "p.go")
+	require.NoError(t, err, "shifted known violations must not fail: %s", out)
+	out, err = run(t.TempDir(), "-n", "-baseline="+filepath.Join(dir, "baseline.json"), file)
+	require.NoError(t, err, "absolute paths must match: %s", out)
+
+	require.NoError(t, os.WriteFile(file, []byte(shifted+violation), 0o644))
+	out, err = run(sub, "-n", "-v", "-baseline=../baseline.json", "p.go")
+	require.Error(t, err)
+	require.Contains(t, out, "would be modified")
+	require.Contains(t, out, ":12:2 (nlreturn)")
+	require.NotContains(t, out, ":7:2 (nlreturn)")
+	require.Contains(t, out, "1 files have violations not in the baseline")
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	return string(out)
+}
+
 func readFile(t *testing.T, path string) []byte {
 	v, err := os.ReadFile(path)
 	require.NoError(t, err)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/git"
+)
+
+// processStaged formats the files staged in the git index rather than
+// their working tree versions, so that partially staged files are checked as
+// they will be committed. Without -w (or with -n) unformatted files are
+// reported and fail the run. With -w a formatted file is written to both the
+// index and the working tree when they are identical; otherwise it is
+// reported, since writing it would mix up staged and unstaged changes.
+func processStaged(ctx context.Context, formatter *nlreturnfmt.Formatter) error {
+	root, err := git.Root(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("git.Root: %w", err)
+	}
+
+	files, err := git.Staged(ctx, root)
+	if err != nil {
+		return fmt.Errorf("git.Staged: %w", err)
+	}
+
+	wd := workDir()
+	unformatted := 0
+	for _, file := range files {
+		if !formattable(file.Path) || !regularMode(file.Mode) {
+			continue
+		}
+
+		filename := relPath(wd, filepath.Join(root, filepath.FromSlash(file.Path)))
+		ok, err := processStagedFile(ctx, formatter, root, filename, file)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			unformatted++
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d staged files are not formatted", unformatted)
+	}
+
+	return nil
+}
+
+// processStagedFile reports whether the staged file is formatted once it returns.
+func processStagedFile(
+	ctx context.Context, formatter *nlreturnfmt.Formatter, root, filename string, file git.StagedFile,
+) (bool, error) {
+	src, err := git.ReadBlob(ctx, root, file.Object)
+	if err != nil {
+		return false, fmt.Errorf("git.ReadBlob: %w", err)
+	}
+
+	result, modified, err := formatter.FormatFile(ctx, filename, src)
+	if err != nil {
+		return false, fmt.Errorf("formatter.FormatFile: %w", err)
+	}
+
+	switch {
+	case !modified:
+		if *verbose {
+			fmt.Printf("%s: no changes needed\n", filename)
+		}
+
+		return true, nil
+	case !*write || *dryRun:
+		fmt.Printf("%s: would be modified\n", filename)
+
+		return false, nil
+	}
+
+	worktree, err := os.ReadFile(filename)
+	if err != nil {
+		return false, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	if !bytes.Equal(worktree, src) {
+		fmt.Printf("%s: not written, working tree differs from index\n", filename)
+
+		return false, nil
+	}
+
+	if err = git.WriteIndex(ctx, root, file, result); err != nil {
+		return false, fmt.Errorf("git.WriteIndex: %w", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false, fmt.Errorf("os.Stat: %w", err)
+	}
+	if err = os.WriteFile(filename, result, info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("os.WriteFile: %w", err)
+	}
+	if *verbose {
+		fmt.Printf("%s: formatted\n", filename)
+	}
+
+	return true, nil
+}
+
+// regularMode reports whether a git file mode is a regular file, as opposed
+// to a symlink or submodule.
+func regularMode(mode string) bool {
+	return mode == "100644" || mode == "100755"
+}
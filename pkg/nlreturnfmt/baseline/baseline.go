@@ -0,0 +1,188 @@
+// Package baseline records known violations, so that check runs on a legacy
+// code base fail only on new ones.
+package baseline
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+)
+
+type (
+	// Baseline counts known violations by fingerprint. It is safe for
+	// concurrent use.
+	Baseline struct {
+		root   string // File names are stored relative to root.
+		mu     sync.Mutex
+		counts map[fingerprint]int
+	}
+	// fingerprint identifies a violation without its line number, so that it
+	// survives edits elsewhere in the file. Identical statements in one
+	// function share a fingerprint and are told apart by their count.
+	fingerprint struct {
+		File   string
+		Func   string
+		Rule   string
+		Source string
+	}
+	// entry is a fingerprint as stored in the baseline file.
+	entry struct {
+		File   string `json:"file"`
+		Func   string `json:"func,omitempty"`
+		Rule   string `json:"rule"`
+		Source string `json:"source"`
+		Count  int    `json:"count"`
+	}
+)
+
+// New returns an empty baseline storing file names relative to root, so that
+// it matches however the files are passed, e.g. from another directory.
+func New(root string) *Baseline {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+
+	return &Baseline{root: root, counts: make(map[fingerprint]int)}
+}
+
+// FindRoot returns the nearest directory from dir up that holds a go.mod file
+// or a .git entry, i.e. the module or repository root, or dir itself.
+func FindRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	for d := abs; ; {
+		for _, marker := range []string{"go.mod", ".git"} {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d
+			}
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return abs
+		}
+		d = parent
+	}
+}
+
+// Load reads a baseline file written by Save, see New for root.
+func Load(name, root string) (*Baseline, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var entries []entry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	b := New(root)
+	for _, e := range entries {
+		b.counts[fingerprint{File: e.File, Func: e.Func, Rule: e.Rule, Source: e.Source}] += e.Count
+	}
+
+	return b, nil
+}
+
+// Save writes the baseline to a file, sorted so that it diffs well.
+func (b *Baseline) Save(name string) error {
+	b.mu.Lock()
+	entries := make([]entry, 0, len(b.counts))
+	for fp, count := range b.counts {
+		entries = append(entries, entry{File: fp.File, Func: fp.Func, Rule: fp.Rule, Source: fp.Source, Count: count})
+	}
+	b.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Func, b.Func),
+			cmp.Compare(a.Rule, b.Rule),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	//nolint: gosec
+	if err = os.WriteFile(name, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	return nil
+}
+
+// Add records the changes of a file as known violations.
+func (b *Baseline) Add(changes []bytefmt.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range changes {
+		b.counts[b.fingerprintOf(c)]++
+	}
+}
+
+// Filter drops the changes of a file that are known violations and returns
+// the new ones. Of several changes sharing a fingerprint, the first ones in
+// the file up to the recorded count are considered known.
+func (b *Baseline) Filter(changes []bytefmt.Change) []bytefmt.Change {
+	return b.NewFilter()(changes)
+}
+
+// NewFilter returns a filter like Filter for a file formatted in several
+// parts, e.g. the code blocks of a Markdown document. The counts span all
+// calls of the filter, which must be made in the order of the parts.
+func (b *Baseline) NewFilter() func(changes []bytefmt.Change) []bytefmt.Change {
+	seen := make(map[fingerprint]int)
+
+	return func(changes []bytefmt.Change) []bytefmt.Change {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		return slices.DeleteFunc(changes, func(c bytefmt.Change) bool {
+			fp := b.fingerprintOf(c)
+			seen[fp]++
+
+			return seen[fp] <= b.counts[fp]
+		})
+	}
+}
+
+func (b *Baseline) fingerprintOf(c bytefmt.Change) fingerprint {
+	return fingerprint{
+		File:   b.rel(c.Pos.Filename),
+		Func:   c.Func,
+		Rule:   c.Rule,
+		Source: c.Source,
+	}
+}
+
+// rel returns filename relative to the root, slash separated. Files outside
+// of the root keep their absolute name.
+func (b *Baseline) rel(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(filename))
+	}
+
+	rel, err := filepath.Rel(b.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(abs)
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,123 @@
+package baseline_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/baseline"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const legacy = `package p
+
+func (t *T) a() error {
+	println()
+	return nil
+}
+
+func b() {
+	for {
+		println()
+		break
+	}
+	println()
+	return
+}
+`
+
+// shifted moves the legacy violations down, duplicates one of them and adds
+// a new one.
+const shifted = `package p
+
+import "fmt"
+
+func (t *T) a() error {
+	fmt.Println()
+	println()
+	return nil
+}
+
+func b() {
+	for {
+		println()
+		break
+	}
+	for {
+		println()
+		break
+	}
+	println()
+	return
+}
+
+func c() {
+	println()
+	return
+}
+`
+
+func TestBaseline(t *testing.T) {
+	res, err := bytefmt.New().Format("p.go", []byte(legacy))
+	require.NoError(t, err)
+	require.Len(t, res.Changes, 3)
+	assert.Equal(t, "(*T).a", res.Changes[0].Func)
+	assert.Equal(t, "return nil", res.Changes[0].Source)
+
+	root := t.TempDir()
+	recorded := baseline.New(root)
+	recorded.Add(res.Changes)
+	name := filepath.Join(root, "baseline.json")
+	require.NoError(t, recorded.Save(name))
+
+	sut, err := baseline.Load(name, root)
+	require.NoError(t, err)
+
+	res, err = bytefmt.New(bytefmt.WithFilter(sut.Filter)).Format("p.go", []byte(legacy))
+	require.NoError(t, err)
+	assert.False(t, res.Modified, "known violations must be suppressed")
+
+	res, err = bytefmt.New(bytefmt.WithFilter(sut.Filter)).Format("p.go", []byte(shifted))
+	require.NoError(t, err)
+	require.Len(t, res.Changes, 2)
+	assert.Equal(t, 18, res.Changes[0].Pos.Line, "the second identical break is new")
+	assert.Equal(t, "c", res.Changes[1].Func)
+
+	res, err = bytefmt.New(bytefmt.WithFilter(sut.Filter)).Format("other.go", []byte(legacy))
+	require.NoError(t, err)
+	assert.Len(t, res.Changes, 3, "violations are recorded per file")
+}
+
+func TestBaseline_Subdirectory(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module m\n"), 0o600))
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	assert.Equal(t, root, baseline.FindRoot(sub))
+
+	// Recorded from the root with a relative path.
+	t.Chdir(root)
+	res, err := bytefmt.New().Format(filepath.Join("sub", "p.go"), []byte(legacy))
+	require.NoError(t, err)
+	recorded := baseline.New(baseline.FindRoot("."))
+	recorded.Add(res.Changes)
+	name := filepath.Join(root, "baseline.json")
+	require.NoError(t, recorded.Save(name))
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"file": "sub/p.go"`)
+
+	// Checked from the subdirectory, and with an absolute path.
+	t.Chdir(sub)
+	sut, err := baseline.Load(name, baseline.FindRoot(filepath.Dir(filepath.Join("..", "baseline.json"))))
+	require.NoError(t, err)
+	for _, filename := range []string{"p.go", filepath.Join(sub, "p.go")} {
+		res, err = bytefmt.New(bytefmt.WithFilter(sut.Filter)).Format(filename, []byte(legacy))
+		require.NoError(t, err)
+		assert.False(t, res.Modified, "known violations of %s must be suppressed", filename)
+	}
+}
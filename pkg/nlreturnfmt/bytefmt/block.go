@@ -0,0 +1,96 @@
+package bytefmt
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// stmtList is the statement list enclosing the statement at a cursor.
+type stmtList struct {
+	stmts []ast.Stmt
+	index int
+	// open is the end of the '{' or ':' that starts the list.
+	open token.Pos
+}
+
+// enclosingList returns the statement list of the block, case clause or
+// select clause that directly contains the statement at the cursor.
+func enclosingList(c *astutil.Cursor) (stmtList, bool) {
+	l := stmtList{index: c.Index()}
+
+	switch node := c.Parent().(type) {
+	case *ast.CaseClause:
+		l.stmts, l.open = node.Body, node.Colon+1
+	case *ast.CommClause:
+		l.stmts, l.open = node.Body, node.Colon+1
+	case *ast.BlockStmt:
+		l.stmts, l.open = node.List, node.Lbrace+1
+	default:
+		return stmtList{}, false
+	}
+
+	return l, l.index >= 0
+}
+
+func (l stmtList) first() bool { return l.index == 0 }
+
+// prevEnd returns the end of the previous statement or of the list opening.
+func (l stmtList) prevEnd() token.Pos {
+	if l.first() {
+		return l.open
+	}
+
+	return l.stmts[l.index-1].End()
+}
+
+// size measures the statements preceding the current one in the list.
+// Blank lines directly above the statement do not count, so that removing
+// them does not change the result.
+func (l stmtList) size(p *Pass, m Measure) int {
+	if m == MeasureStatements {
+		return l.index
+	}
+
+	return p.Line(l.prevEnd()) + 1 - p.Line(l.stmts[0].Pos())
+}
+
+// requiresBlankLine reports whether the current statement must be separated
+// from the preceding ones. It is not required if the statement is the first
+// in the block, or if the block is too short (not larger than blockSize).
+func (l stmtList) requiresBlankLine(p *Pass, blockSize int, m Measure) bool {
+	return !l.first() && l.size(p, m) >= blockSize
+}
+
+// insertBlankLine inserts a blank line before the current statement, unless
+// it is separated by a blank line or a comment already.
+func (l stmtList) insertBlankLine(p *Pass, name string) {
+	pos := l.stmts[l.index].Pos()
+	if p.Line(pos)-p.Line(l.prevEnd()) > 1 {
+		return
+	}
+
+	if edit, ok := p.InsertBlankLine(pos); ok {
+		p.Report(pos, "insert blank line before "+name, edit)
+	}
+}
+
+// labeled reports whether the statement at the cursor is wrapped by a label.
+// Such statements are checked with the outermost label instead.
+func labeled(c *astutil.Cursor) bool {
+	_, ok := c.Parent().(*ast.LabeledStmt)
+
+	return ok
+}
+
+// unlabel returns the statement wrapped by (possibly nested) labels.
+func unlabel(stmt ast.Stmt) ast.Stmt {
+	for {
+		labeled, ok := stmt.(*ast.LabeledStmt)
+		if !ok {
+			return stmt
+		}
+		stmt = labeled.Stmt
+	}
+}
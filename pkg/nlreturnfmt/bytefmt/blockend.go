@@ -0,0 +1,103 @@
+package bytefmt
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const BlockEndName = "block-end"
+
+// BlockEnd inserts blank lines after the closing braces of multi-line if,
+// for, switch and select statements that are followed by another statement.
+// An else branch or a closing brace of the enclosing block may follow directly.
+type BlockEnd struct {
+	// ExemptErrCheck allows statements to follow "if err != nil" blocks
+	// directly, so that chains of calls and error checks stay compact.
+	ExemptErrCheck bool
+}
+
+func NewBlockEnd() *BlockEnd {
+	return &BlockEnd{
+		ExemptErrCheck: true,
+	}
+}
+
+func (r *BlockEnd) Name() string { return BlockEndName }
+
+func (r *BlockEnd) Nodes() []ast.Node {
+	return []ast.Node{
+		(*ast.IfStmt)(nil),
+		(*ast.ForStmt)(nil),
+		(*ast.RangeStmt)(nil),
+		(*ast.SwitchStmt)(nil),
+		(*ast.TypeSwitchStmt)(nil),
+		(*ast.SelectStmt)(nil),
+		(*ast.LabeledStmt)(nil),
+	}
+}
+
+func (r *BlockEnd) Check(p *Pass, c *astutil.Cursor) {
+	if labeled(c) {
+		return
+	}
+
+	l, ok := enclosingList(c)
+	if !ok || l.index == len(l.stmts)-1 {
+		return
+	}
+
+	stmt := l.stmts[l.index]
+	name := r.target(unlabel(stmt))
+	if name == "" || p.Line(stmt.End()) == p.Line(stmt.Pos()) {
+		return
+	}
+
+	next := l.stmts[l.index+1]
+	if p.Line(next.Pos())-p.Line(stmt.End()) != 1 {
+		return
+	}
+
+	if edit, ok := p.InsertBlankLine(next.Pos()); ok {
+		p.Report(next.Pos(), "insert blank line after "+name+" block", edit)
+	}
+}
+
+// target returns the name of stmt if it is a block statement checked by the rule.
+func (r *BlockEnd) target(stmt ast.Stmt) string {
+	switch stmt := stmt.(type) {
+	case *ast.IfStmt:
+		if r.ExemptErrCheck && isErrCheck(stmt) {
+			return ""
+		}
+
+		return token.IF.String()
+	case *ast.ForStmt, *ast.RangeStmt:
+		return token.FOR.String()
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		return token.SWITCH.String()
+	case *ast.SelectStmt:
+		return token.SELECT.String()
+	default:
+		return ""
+	}
+}
+
+// isErrCheck reports whether stmt is "if err != nil { ... }" without else.
+// Any variable named err or ending with Err counts as an error.
+func isErrCheck(stmt *ast.IfStmt) bool {
+	cond, ok := stmt.Cond.(*ast.BinaryExpr)
+	if !ok || cond.Op != token.NEQ || stmt.Else != nil {
+		return false
+	}
+
+	x, ok := cond.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	y, ok := cond.Y.(*ast.Ident)
+
+	return ok && y.Name == "nil" && (x.Name == "err" || strings.HasSuffix(x.Name, "Err"))
+}
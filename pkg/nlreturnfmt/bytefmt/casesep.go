@@ -0,0 +1,68 @@
+package bytefmt
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const CaseSepName = "case-sep"
+
+// CaseSep enforces, or forbids, a blank line between the case clauses of
+// switch, type switch and select statements. Only clauses following a clause
+// of at least MinLines lines are checked.
+type CaseSep struct {
+	Forbid   bool
+	MinLines int
+}
+
+func NewCaseSep() *CaseSep {
+	return &CaseSep{
+		MinLines: 2, //nolint: mnd // Multi-line clauses.
+	}
+}
+
+func (r *CaseSep) Name() string { return CaseSepName }
+
+func (r *CaseSep) Nodes() []ast.Node {
+	return []ast.Node{(*ast.CaseClause)(nil), (*ast.CommClause)(nil)}
+}
+
+func (r *CaseSep) Check(p *Pass, c *astutil.Cursor) {
+	l, ok := enclosingList(c)
+	if !ok || l.first() {
+		return
+	}
+
+	prev := l.stmts[l.index-1]
+	if p.Line(prev.End())-p.Line(prev.Pos())+1 < r.MinLines {
+		return
+	}
+
+	name := clauseName(c.Node())
+	if !r.Forbid {
+		l.insertBlankLine(p, name)
+
+		return
+	}
+
+	pos := c.Node().Pos()
+	if edit, ok := p.DeleteBlankLines(p.Line(prev.End())+1, p.Line(pos)-1); ok {
+		p.Report(pos, "remove blank line before "+name, edit)
+	}
+}
+
+func clauseName(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.CaseClause:
+		if node.List == nil {
+			return "default"
+		}
+	case *ast.CommClause:
+		if node.Comm == nil {
+			return "default"
+		}
+	}
+
+	return "case"
+}
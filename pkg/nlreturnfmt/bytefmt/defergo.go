@@ -0,0 +1,64 @@
+package bytefmt
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const DeferGoName = "defer-go"
+
+// DeferGo inserts blank lines before defer and go statements. Consecutive
+// defer statements, as well as consecutive go statements, stay cuddled.
+// Blocks are measured the same way as by NLReturn.
+type DeferGo struct {
+	BlockSize int
+	Measure   Measure
+}
+
+func NewDeferGo() *DeferGo {
+	return &DeferGo{
+		BlockSize: 1,
+	}
+}
+
+func (r *DeferGo) Name() string { return DeferGoName }
+
+func (r *DeferGo) Nodes() []ast.Node {
+	return []ast.Node{(*ast.DeferStmt)(nil), (*ast.GoStmt)(nil), (*ast.LabeledStmt)(nil)}
+}
+
+func (r *DeferGo) Check(p *Pass, c *astutil.Cursor) {
+	if labeled(c) {
+		return
+	}
+
+	l, ok := enclosingList(c)
+	if !ok {
+		return
+	}
+
+	kind := deferGoKind(l.stmts[l.index])
+	if kind == token.ILLEGAL || !l.requiresBlankLine(p, r.BlockSize, r.Measure) {
+		return
+	}
+	if deferGoKind(l.stmts[l.index-1]) == kind {
+		return
+	}
+
+	l.insertBlankLine(p, kind.String())
+}
+
+// deferGoKind returns token.DEFER or token.GO for defer and go statements,
+// and token.ILLEGAL otherwise.
+func deferGoKind(stmt ast.Stmt) token.Token {
+	switch unlabel(stmt).(type) {
+	case *ast.DeferStmt:
+		return token.DEFER
+	case *ast.GoStmt:
+		return token.GO
+	default:
+		return token.ILLEGAL
+	}
+}
@@ -1,12 +1,12 @@
 package bytefmt
 
 import (
-	"bytes"
 	"fmt"
 	"go/ast"
-	"go/format"
 	"go/parser"
 	"go/token"
+	"reflect"
+	"slices"
 	"strings"
 
 	"golang.org/x/tools/go/ast/astutil"
@@ -14,101 +14,284 @@ import (
 
 type (
 	Formatter struct {
-		fset      *token.FileSet
-		blockSize int
+		rules            []Rule
+		dispatch         map[reflect.Type][]rankedRule
+		shortFuncSize    int
+		shortFuncMeasure Measure
+		filter           func([]Change) []Change
 	}
 	Result struct {
 		Filename string
 		Value    []byte
 		Modified bool
 		Details  string
+		Changes  []Change
+	}
+	// Change is a single fix reported by a rule.
+	Change struct {
+		Rule    string
+		Pos     token.Position
+		Message string
+		Edits   []Edit
+		// Func is the enclosing top-level function, e.g. "(*T).M", empty
+		// outside of function declarations.
+		Func string
+		// Source is the line at Pos without surrounding whitespace. Along with
+		// Func it identifies the change when lines shift.
+		Source string
+
+		rank int // Index of the rule, lower wins conflicts.
+	}
+	// LineRange is a range of lines, both ends inclusive.
+	LineRange struct {
+		Start int
+		End   int
+	}
+	// Edit replaces the source bytes in [Start, End) with Text.
+	Edit struct {
+		Start int
+		End   int
+		Text  string
 	}
 )
 
-func New(blockSize int) *Formatter {
-	return &Formatter{
-		fset:      token.NewFileSet(),
-		blockSize: blockSize,
+// New returns a formatter applying the configured rules, NLReturn by default.
+func New(opts ...Option) *Formatter {
+	f := &Formatter{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if len(f.rules) == 0 {
+		f.rules = []Rule{NewNLReturn()}
+	}
+
+	f.dispatch = make(map[reflect.Type][]rankedRule)
+	for i, rule := range f.rules {
+		for _, node := range rule.Nodes() {
+			typ := reflect.TypeOf(node)
+			f.dispatch[typ] = append(f.dispatch[typ], rankedRule{rule: rule, rank: i})
+		}
+	}
+
+	return f
+}
+
+// Fingerprint identifies the formatting options, e.g. to key caches of
+// formatted files.
+func (f *Formatter) Fingerprint() string {
+	parts := make([]string, 0, len(f.rules))
+	for _, rule := range f.rules {
+		parts = append(parts, fmt.Sprintf("%s%+v", rule.Name(), rule))
+	}
+
+	if f.shortFuncSize > 0 {
+		parts = append(parts, fmt.Sprintf("short-funcs=%d %s", f.shortFuncSize, f.shortFuncMeasure))
 	}
+
+	return strings.Join(parts, ";")
 }
 
+// Format applies the rules to src by inserting and deleting blank lines only,
+// the rest of src is kept byte for byte. Unlike gofmt, the layout is not
+// normalized, so that line ranges and fragments can be formatted without
+// touching other code. Statements sharing a line with the previous one are
+// left alone, since separating them would need reformatting; run gofmt first.
+//
+// Format is safe for concurrent use. Every call parses src into its own
+// token.FileSet, so memory is released once the call returns.
 func (f *Formatter) Format(filename string, src []byte) (Result, error) {
-	file, err := parser.ParseFile(f.fset, filename, src, parser.ParseComments)
+	return f.FormatRange(filename, src, nil)
+}
+
+// FormatRange is like Format, but only applies changes positioned within the
+// given line ranges, e.g. a selection in an editor. Nil ranges mean the whole
+// file, while empty non-nil ranges leave the file alone.
+func (f *Formatter) FormatRange(filename string, src []byte, ranges []LineRange) (Result, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
 	if err != nil {
 		return Result{}, fmt.Errorf("parser.ParseFile: %w", err)
 	}
 
-	var (
-		modified bool
-		details  = &strings.Builder{}
-	)
-
-	res := astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
-		var name string
+	p := &Pass{
+		Fset:    fset,
+		File:    file,
+		Src:     src,
+		tokFile: fset.File(file.Pos()),
+	}
 
+	pre := func(c *astutil.Cursor) bool {
+		var body *ast.BlockStmt
 		switch node := c.Node().(type) {
-		case *ast.ReturnStmt:
-			name = "return"
-		case *ast.BranchStmt:
-			name = node.Tok.String()
+		case *ast.FuncDecl:
+			body = node.Body
+		case *ast.FuncLit:
+			body = node.Body
 		default:
 			return true
 		}
 
-		if f.shouldInsert(c) {
-			c.InsertBefore(newBlankLine(c.Node()))
-			modified = true
+		short := f.short(p, body)
+		p.funcs = append(p.funcs, enclosingFunc{node: c.Node(), short: short})
+		if short {
+			p.shortBodies = append(p.shortBodies, lineSpan{from: p.Line(body.Lbrace), to: p.Line(body.Rbrace)})
+		}
 
-			pos := f.fset.Position(c.Node().Pos())
-			_, _ = fmt.Fprintf(details, "- insert blank line before %s at %s\n", name, pos)
+		return true
+	}
+	post := func(c *astutil.Cursor) bool {
+		short := false
+		switch c.Node().(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			// Rules checking the function itself, e.g. max-blank, are
+			// exempt along with its statements.
+			short = p.funcs[len(p.funcs)-1].short
+			p.funcs = p.funcs[:len(p.funcs)-1]
+		}
+		if short || len(p.funcs) != 0 && p.funcs[len(p.funcs)-1].short {
+			return true
+		}
+
+		for _, r := range f.dispatch[reflect.TypeOf(c.Node())] {
+			p.rule = r
+			r.rule.Check(p, c)
 		}
 
 		return true
-	})
+	}
+	astutil.Apply(file, pre, post)
+
+	if ranges != nil {
+		p.changes = slices.DeleteFunc(p.changes, func(c Change) bool {
+			return !slices.ContainsFunc(ranges, func(r LineRange) bool { return r.Contains(c.Pos.Line) })
+		})
+	}
+	if f.filter != nil {
+		p.changes = f.filter(p.changes)
+	}
 
-	var buf bytes.Buffer
-	if err = format.Node(&buf, f.fset, res); err != nil {
-		return Result{}, err
+	changes := resolve(p.changes)
+	if len(changes) == 0 {
+		return Result{
+			Filename: filename,
+			Value:    src,
+		}, nil
 	}
 
 	return Result{
 		Filename: filename,
-		Value:    buf.Bytes(),
-		Modified: modified,
-		Details:  details.String(),
+		Value:    apply(src, changes),
+		Modified: true,
+		Details:  Describe(changes),
+		Changes:  changes,
 	}, nil
 }
 
-func (f *Formatter) shouldInsert(ret *astutil.Cursor) bool {
-	var block []ast.Stmt
-
-	switch node := ret.Parent().(type) {
-	case *ast.CaseClause:
-		block = node.Body
-	case *ast.CommClause:
-		block = node.Body
-	case *ast.BlockStmt:
-		block = node.List
-	default:
-		return false
+// Describe lists the changes as in Result.Details.
+func Describe(changes []Change) string {
+	details := &strings.Builder{}
+	for _, change := range changes {
+		_, _ = fmt.Fprintf(details, "- %s at %s (%s)\n", change.Message, change.Pos, change.Rule)
 	}
 
-	// Do not add a newline if the statement is the first in the block,
-	// or if the block is too short (fewer lines than blockSize).
-	if ret.Index() == 0 || f.line(ret.Node().Pos())-f.line(block[0].Pos()) < f.blockSize {
+	return details.String()
+}
+
+func (r LineRange) Contains(line int) bool { return r.Start <= line && line <= r.End }
+
+// short reports whether a function body is exempt by WithShortFuncs.
+func (f *Formatter) short(p *Pass, body *ast.BlockStmt) bool {
+	if f.shortFuncSize <= 0 || body == nil {
 		return false
 	}
 
-	return f.line(ret.Node().Pos())-f.line(block[ret.Index()-1].End()) <= 1
+	if f.shortFuncMeasure == MeasureLines {
+		return p.Line(body.Rbrace)-p.Line(body.Lbrace)+1 <= f.shortFuncSize
+	}
+
+	var stmts int
+	ast.Inspect(body, func(node ast.Node) bool {
+		if _, ok := node.(ast.Stmt); ok && node != body {
+			if _, ok = node.(*ast.BlockStmt); !ok {
+				stmts++
+			}
+		}
+
+		return stmts <= f.shortFuncSize
+	})
+
+	return stmts <= f.shortFuncSize
+}
+
+// resolve drops changes whose edits conflict with a change of a rule of
+// higher precedence and orders the rest by position. Identical edits reported
+// by several rules are applied once.
+func resolve(changes []Change) []Change {
+	slices.SortStableFunc(changes, func(a, b Change) int {
+		if a.rank != b.rank {
+			return a.rank - b.rank
+		}
+
+		return a.Pos.Offset - b.Pos.Offset
+	})
+
+	var (
+		accepted = make([]Change, 0, len(changes))
+		edits    []Edit
+	)
+	for _, change := range changes {
+		if slices.ContainsFunc(change.Edits, func(e Edit) bool { return conflicts(edits, e) }) {
+			continue
+		}
+		accepted = append(accepted, change)
+		edits = append(edits, change.Edits...)
+	}
+	slices.SortStableFunc(accepted, func(a, b Change) int { return a.Pos.Offset - b.Pos.Offset })
+
+	return accepted
 }
 
-func (f *Formatter) line(pos token.Pos) int { return f.fset.Position(pos).Line }
+func conflicts(edits []Edit, e Edit) bool {
+	for _, other := range edits {
+		switch {
+		case other == e:
+		case other.Start == e.Start && other.End == e.End:
+			return true
+		case other.Start < e.End && e.Start < other.End:
+			return true
+		}
+	}
+
+	return false
+}
 
-func newBlankLine(node ast.Node) *ast.ExprStmt {
-	return &ast.ExprStmt{
-		X: &ast.Ident{
-			NamePos: node.Pos(),
-			Name:    "", // Empty identifier creates line break
-		},
+// apply returns src with the edits of changes applied. Edits must not conflict.
+func apply(src []byte, changes []Change) []byte {
+	var edits []Edit
+	for _, change := range changes {
+		for _, e := range change.Edits {
+			if !slices.Contains(edits, e) {
+				edits = append(edits, e)
+			}
+		}
 	}
+	slices.SortStableFunc(edits, func(a, b Edit) int {
+		if a.Start != b.Start {
+			return a.Start - b.Start
+		}
+
+		return a.End - b.End
+	})
+
+	var (
+		buf  = make([]byte, 0, len(src)+len(edits))
+		last int
+	)
+	for _, e := range edits {
+		buf = append(buf, src[last:e.Start]...)
+		buf = append(buf, e.Text...)
+		last = e.End
+	}
+
+	return append(buf, src[last:]...)
 }
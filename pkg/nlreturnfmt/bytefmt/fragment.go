@@ -0,0 +1,93 @@
+package bytefmt
+
+import (
+	"bytes"
+	"strings"
+)
+
+// fragments wrap source that is not a complete file into one, tried in order
+// like gofmt does: a declaration list, then a statement list.
+var fragments = []struct{ prefix, suffix string }{
+	{prefix: "package p\n"},
+	{prefix: "package p\n\nfunc _() {\n", suffix: "}\n"},
+}
+
+// FormatFragment is like FormatRange, but src may also be a declaration list
+// or a statement list, e.g. a snippet or an editor selection. A fragment is
+// wrapped into a file, formatted and unwrapped again; since only blank lines
+// are inserted or deleted, its indentation is preserved. Changes are
+// positioned in src. If src is none of these, the error of parsing it as a
+// file is returned.
+func (f *Formatter) FormatFragment(filename string, src []byte, ranges []LineRange) (Result, error) {
+	res, err := f.FormatRange(filename, src, ranges)
+	if err == nil {
+		return res, nil
+	}
+
+	for _, w := range fragments {
+		if res, ok := f.formatWrapped(filename, src, ranges, w.prefix, w.suffix); ok {
+			return res, nil
+		}
+	}
+
+	return Result{}, err
+}
+
+// formatWrapped reports false if the wrapped src does not parse. Changes are
+// limited to the lines of src, so that the wrapper is left intact.
+func (f *Formatter) formatWrapped(
+	filename string, src []byte, ranges []LineRange, prefix, suffix string,
+) (Result, bool) {
+	lines := bytes.Count(src, []byte("\n"))
+	if len(src) != 0 && !bytes.HasSuffix(src, []byte("\n")) {
+		lines++
+		if suffix != "" {
+			suffix = "\n" + suffix
+		}
+	}
+
+	shift := strings.Count(prefix, "\n")
+	inner := []LineRange{{Start: shift + 1, End: shift + lines}}
+	if ranges != nil {
+		inner = make([]LineRange, 0, len(ranges))
+		for _, r := range ranges {
+			inner = append(inner, LineRange{Start: r.Start + shift, End: r.End + shift})
+		}
+	}
+
+	wrapped := make([]byte, 0, len(prefix)+len(src)+len(suffix))
+	wrapped = append(append(append(wrapped, prefix...), src...), suffix...)
+	res, err := f.FormatRange(filename, wrapped, inner)
+	if err != nil {
+		return Result{}, false
+	}
+	if !res.Modified {
+		return Result{Filename: filename, Value: src}, true
+	}
+
+	value, ok := bytes.CutPrefix(res.Value, []byte(prefix))
+	if !ok {
+		return Result{}, false
+	}
+	if value, ok = bytes.CutSuffix(value, []byte(suffix)); !ok {
+		return Result{}, false
+	}
+
+	for i := range res.Changes {
+		c := &res.Changes[i]
+		c.Pos.Line -= shift
+		c.Pos.Offset -= len(prefix)
+		for j := range c.Edits {
+			c.Edits[j].Start -= len(prefix)
+			c.Edits[j].End -= len(prefix)
+		}
+	}
+
+	return Result{
+		Filename: filename,
+		Value:    value,
+		Modified: true,
+		Details:  Describe(res.Changes),
+		Changes:  res.Changes,
+	}, true
+}
@@ -0,0 +1,112 @@
+package bytefmt
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const MaxBlankName = "max-blank"
+
+// MaxBlank caps runs of consecutive blank lines inside function bodies at Max.
+// Blank lines inside raw strings and comments are kept.
+type MaxBlank struct {
+	Max int
+}
+
+func NewMaxBlank() *MaxBlank {
+	return &MaxBlank{
+		Max: 1,
+	}
+}
+
+func (r *MaxBlank) Name() string { return MaxBlankName }
+
+func (r *MaxBlank) Nodes() []ast.Node {
+	return []ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil)}
+}
+
+// Check handles the outermost function only, since it covers the bodies of
+// nested function literals.
+func (r *MaxBlank) Check(p *Pass, c *astutil.Cursor) {
+	if p.EnclosingFunc() != nil {
+		return
+	}
+
+	var body *ast.BlockStmt
+
+	switch node := c.Node().(type) {
+	case *ast.FuncDecl:
+		body = node.Body
+	case *ast.FuncLit:
+		body = node.Body
+	}
+	if body == nil {
+		return
+	}
+
+	limit := max(r.Max, 0)
+	// Bodies of nested short function literals are exempt as well.
+	spans := append(multiLineSpans(p, body), p.shortBodies...)
+	first, last := p.Line(body.Lbrace)+1, p.Line(body.Rbrace)-1
+	for line := first; line <= last; line++ {
+		if !p.BlankLine(line) {
+			continue
+		}
+
+		end := line
+		for end < last && p.BlankLine(end+1) {
+			end++
+		}
+		if end-line+1 > limit && !within(spans, line, end) {
+			from := line + limit
+			if edit, ok := p.DeleteBlankLines(from, end); ok {
+				p.Report(p.tokFile.LineStart(from), "remove extra blank lines", edit)
+			}
+		}
+		line = end
+	}
+}
+
+// lineSpan is a range of lines.
+type lineSpan struct{ from, to int }
+
+// multiLineSpans returns the lines of raw strings and comments in node that
+// span multiple lines.
+func multiLineSpans(p *Pass, node ast.Node) []lineSpan {
+	var spans []lineSpan
+	add := func(n ast.Node) {
+		if from, to := p.Line(n.Pos()), p.Line(n.End()); from != to {
+			spans = append(spans, lineSpan{from: from, to: to})
+		}
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			add(lit)
+		}
+
+		return true
+	})
+	for _, group := range p.File.Comments {
+		if group.Pos() >= node.Pos() && group.End() <= node.End() {
+			for _, comment := range group.List {
+				add(comment)
+			}
+		}
+	}
+
+	return spans
+}
+
+// within reports whether the lines from..to are inside one of the spans.
+func within(spans []lineSpan, from, to int) bool {
+	for _, span := range spans {
+		if span.from < from && to < span.to {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package bytefmt
+
+import "fmt"
+
+// Measure selects how the size of a block is measured.
+type Measure int
+
+const (
+	// MeasureLines counts source lines, so a multi-line call is a large block.
+	MeasureLines Measure = iota
+	// MeasureStatements counts statements regardless of their length.
+	MeasureStatements
+)
+
+func ParseMeasure(s string) (Measure, error) {
+	switch s {
+	case "lines":
+		return MeasureLines, nil
+	case "statements":
+		return MeasureStatements, nil
+	default:
+		return 0, fmt.Errorf("unknown measure %q, want lines or statements", s)
+	}
+}
+
+func (m Measure) String() string {
+	switch m {
+	case MeasureLines:
+		return "lines"
+	case MeasureStatements:
+		return "statements"
+	default:
+		return fmt.Sprintf("Measure(%d)", int(m))
+	}
+}
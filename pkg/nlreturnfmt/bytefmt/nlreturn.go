@@ -0,0 +1,301 @@
+package bytefmt
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const NLReturnName = "nlreturn"
+
+// NLReturn inserts blank lines before return and branch statements
+// except when the statement is alone inside a statement group.
+type NLReturn struct {
+	// BlockSize is the largest size of a block, up to and including the
+	// statement, that does not require a blank line before the statement.
+	BlockSize int
+	// Measure selects whether BlockSize counts lines or statements.
+	Measure Measure
+	// Kinds selects the enforced statements by keyword: token.RETURN,
+	// token.BREAK, token.CONTINUE, token.GOTO and token.FALLTHROUGH.
+	// All of them are enforced if empty.
+	Kinds []token.Token
+	// Strict also removes blank lines before statements that do not require
+	// them and collapses multiple blank lines into one, so that files converge
+	// to one canonical layout.
+	Strict bool
+	// FuncDecl and FuncLit override the settings for statements whose
+	// innermost enclosing function is a declaration or a literal respectively,
+	// e.g. for callbacks passed to sort.Slice or errgroup.Go.
+	FuncDecl Scope
+	FuncLit  Scope
+	// CuddleAssign, if positive, exempts a return from the rule when the
+	// preceding statement spans at most CuddleAssign lines and assigns a
+	// variable the return uses, e.g. "err := do()" followed by "return err".
+	CuddleAssign int
+	// TerminatingCalls lists calls that never return and are enforced like
+	// return statements, e.g. DefaultTerminatingCalls. Names are qualified
+	// by the package or receiver identifier and may be path.Match patterns.
+	TerminatingCalls []string
+}
+
+// ParseKinds parses a comma separated list of statement keywords for NLReturn.Kinds.
+// An empty list is an error, since empty Kinds enforce every statement.
+func ParseKinds(s string) ([]token.Token, error) {
+	var kinds []token.Token
+	for name := range strings.SplitSeq(s, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		switch kind := token.Lookup(name); kind {
+		case token.RETURN, token.BREAK, token.CONTINUE, token.GOTO, token.FALLTHROUGH:
+			kinds = append(kinds, kind)
+		default:
+			return nil, fmt.Errorf("unknown statement kind %q", name)
+		}
+	}
+
+	if len(kinds) == 0 {
+		return nil, errors.New("no statement kinds given")
+	}
+
+	return kinds, nil
+}
+
+// Scope overrides the settings of a rule for statements in a kind of function.
+type Scope struct {
+	// Disabled turns the rule off.
+	Disabled bool
+	// BlockSize replaces the block size of the rule if not nil.
+	BlockSize *int
+}
+
+// String formats the scope by value, so that Formatter.Fingerprint is stable.
+func (s Scope) String() string {
+	blockSize := "inherit"
+	if s.BlockSize != nil {
+		blockSize = strconv.Itoa(*s.BlockSize)
+	}
+
+	return fmt.Sprintf("{Disabled:%t BlockSize:%s}", s.Disabled, blockSize)
+}
+
+// DefaultTerminatingCalls returns the well-known calls that never return.
+func DefaultTerminatingCalls() []string {
+	return []string{"panic", "os.Exit", "log.Fatal*", "t.Fatal*", "t.Skip*"}
+}
+
+func NewNLReturn() *NLReturn {
+	return &NLReturn{
+		BlockSize: 1,
+	}
+}
+
+func (r *NLReturn) Name() string { return NLReturnName }
+
+func (r *NLReturn) Nodes() []ast.Node {
+	nodes := []ast.Node{(*ast.ReturnStmt)(nil), (*ast.BranchStmt)(nil), (*ast.LabeledStmt)(nil)}
+	if len(r.TerminatingCalls) != 0 {
+		nodes = append(nodes, (*ast.ExprStmt)(nil))
+	}
+
+	return nodes
+}
+
+// Check handles a labeled statement as a whole: the blank line goes before
+// the label, never between the label and the statement.
+func (r *NLReturn) Check(p *Pass, c *astutil.Cursor) {
+	stmt, ok := c.Node().(ast.Stmt)
+	if !ok {
+		return
+	}
+	if labeled(c) {
+		return
+	}
+
+	if name := r.target(unlabel(stmt)); name != "" {
+		r.fix(p, c, name)
+	}
+}
+
+// target returns the name of stmt if it requires a blank line before it.
+func (r *NLReturn) target(stmt ast.Stmt) string {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStmt:
+		if r.enforced(token.RETURN) {
+			return token.RETURN.String()
+		}
+	case *ast.BranchStmt:
+		if r.enforced(stmt.Tok) {
+			return stmt.Tok.String()
+		}
+	case *ast.ExprStmt:
+		return r.terminatingCall(stmt)
+	}
+
+	return ""
+}
+
+func (r *NLReturn) enforced(kind token.Token) bool {
+	return len(r.Kinds) == 0 || slices.Contains(r.Kinds, kind)
+}
+
+// terminatingCall returns the name of the call if it is listed in TerminatingCalls.
+func (r *NLReturn) terminatingCall(stmt *ast.ExprStmt) string {
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+
+	var name string
+
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		name = fun.Name
+	case *ast.SelectorExpr:
+		x, ok := fun.X.(*ast.Ident)
+		if !ok {
+			return ""
+		}
+		name = x.Name + "." + fun.Sel.Name
+	default:
+		return ""
+	}
+
+	for _, pattern := range r.TerminatingCalls {
+		if matched, _ := path.Match(pattern, name); matched {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// cuddled reports whether stmt is a return that may stay cuddled with the
+// preceding assignment according to CuddleAssign.
+func (r *NLReturn) cuddled(p *Pass, stmt ast.Stmt, l stmtList) bool {
+	ret, ok := unlabel(stmt).(*ast.ReturnStmt)
+	if !ok || r.CuddleAssign <= 0 || l.first() {
+		return false
+	}
+
+	prev := l.stmts[l.index-1]
+	if p.Line(prev.End())-p.Line(prev.Pos())+1 > r.CuddleAssign {
+		return false
+	}
+
+	assigned := assignedNames(prev)
+	for _, result := range ret.Results {
+		if usesAny(result, assigned) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// assignedNames returns the variables assigned or declared by stmt.
+func assignedNames(stmt ast.Stmt) []string {
+	var idents []*ast.Ident
+
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range stmt.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok {
+				idents = append(idents, ident)
+			}
+		}
+	case *ast.DeclStmt:
+		decl, ok := stmt.Decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.VAR {
+			return nil
+		}
+		for _, spec := range decl.Specs {
+			if spec, ok := spec.(*ast.ValueSpec); ok {
+				idents = append(idents, spec.Names...)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(idents))
+	for _, ident := range idents {
+		if ident.Name != "_" {
+			names = append(names, ident.Name)
+		}
+	}
+
+	return names
+}
+
+// usesAny reports whether expr refers to any of the names. Field and method
+// names of selectors are not references.
+func usesAny(expr ast.Expr, names []string) bool {
+	var found bool
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			found = found || usesAny(node.X, names)
+
+			return false
+		case *ast.Ident:
+			found = found || slices.Contains(names, node.Name)
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+// scope resolves the settings for the function enclosing the checked statement.
+func (r *NLReturn) scope(p *Pass) Scope {
+	scope := r.FuncDecl
+	if _, ok := p.EnclosingFunc().(*ast.FuncLit); ok {
+		scope = r.FuncLit
+	}
+	if scope.BlockSize == nil {
+		scope.BlockSize = &r.BlockSize
+	}
+
+	return scope
+}
+
+// fix inserts a blank line before the statement at the cursor if required.
+// In strict mode, it also removes blank lines that are not required and
+// collapses multiple blank lines into one.
+func (r *NLReturn) fix(p *Pass, c *astutil.Cursor, name string) {
+	scope := r.scope(p)
+	l, ok := enclosingList(c)
+	if !ok || scope.Disabled {
+		return
+	}
+
+	var (
+		pos      = c.Node().Pos()
+		prevLine = p.Line(l.prevEnd())
+		gap      = p.Line(pos) - prevLine
+		required = l.requiresBlankLine(p, *scope.BlockSize, r.Measure) && !r.cuddled(p, l.stmts[l.index], l)
+	)
+
+	switch {
+	case required && gap <= 1:
+		l.insertBlankLine(p, name)
+	case !r.Strict:
+	case required && gap > 2:
+		if edit, ok := p.DeleteBlankLines(prevLine+2, p.Line(pos)-1); ok {
+			p.Report(pos, "collapse blank lines before "+name, edit)
+		}
+	case !required && gap > 1:
+		if edit, ok := p.DeleteBlankLines(prevLine+1, p.Line(pos)-1); ok {
+			p.Report(pos, "remove blank line before "+name, edit)
+		}
+	}
+}
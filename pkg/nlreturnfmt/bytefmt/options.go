@@ -0,0 +1,25 @@
+package bytefmt
+
+type Option func(*Formatter)
+
+// WithRules sets the rules applied by the formatter, in order of precedence:
+// when edits of two rules conflict, the change of the earlier rule wins.
+func WithRules(rules ...Rule) Option {
+	return func(f *Formatter) { f.rules = append(f.rules, rules...) }
+}
+
+// WithShortFuncs exempts functions, both declarations and literals, whose
+// body spans at most size lines or statements from all rules.
+func WithShortFuncs(size int, m Measure) Option {
+	return func(f *Formatter) {
+		f.shortFuncSize = size
+		f.shortFuncMeasure = m
+	}
+}
+
+// WithFilter sets a filter applied to the changes of every file before they
+// are resolved, e.g. to suppress known violations. Changes dropped by the
+// filter do not block conflicting changes of other rules.
+func WithFilter(filter func(changes []Change) []Change) Option {
+	return func(f *Formatter) { f.filter = filter }
+}
@@ -0,0 +1,233 @@
+package bytefmt
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"sync"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+type (
+	// Rule is a whitespace rule applied by the formatter.
+	Rule interface {
+		// Name identifies the rule in the registry and in change records.
+		Name() string
+		// Nodes returns typed nil pointers of the node kinds the rule checks,
+		// e.g. (*ast.ReturnStmt)(nil).
+		Nodes() []ast.Node
+		// Check decides whether the node at the cursor violates the rule and
+		// reports the fix with Pass.Report.
+		Check(p *Pass, c *astutil.Cursor)
+	}
+	// Pass holds the state of a single Format call shared by all rules.
+	Pass struct {
+		Fset *token.FileSet
+		File *ast.File
+		Src  []byte
+
+		tokFile *token.File
+		rule    rankedRule
+		changes []Change
+		funcs   []enclosingFunc // Functions enclosing the node being checked.
+		// shortBodies are the bodies of functions exempt by WithShortFuncs.
+		shortBodies []lineSpan
+	}
+	enclosingFunc struct {
+		node  ast.Node
+		short bool
+	}
+	rankedRule struct {
+		rule Rule
+		rank int
+	}
+)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]func() Rule
+}{
+	factories: map[string]func() Rule{
+		NLReturnName: func() Rule { return NewNLReturn() },
+		BlockEndName: func() Rule { return NewBlockEnd() },
+		DeferGoName:  func() Rule { return NewDeferGo() },
+		TrimName:     func() Rule { return NewTrim() },
+		CaseSepName:  func() Rule { return NewCaseSep() },
+		MaxBlankName: func() Rule { return NewMaxBlank() },
+	},
+}
+
+// Register makes a rule available by name. It panics if the name is taken.
+func Register(name string, factory func() Rule) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.factories[name]; ok {
+		panic("bytefmt: rule registered twice: " + name)
+	}
+	registry.factories[name] = factory
+}
+
+// NewRule returns the registered rule with its default configuration.
+func NewRule(name string) (Rule, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	factory, ok := registry.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule %q", name)
+	}
+
+	return factory(), nil
+}
+
+// RuleNames returns the sorted names of the registered rules.
+func RuleNames() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Report records a change attributed to the rule being checked.
+func (p *Pass) Report(pos token.Pos, message string, edits ...Edit) {
+	start, end := p.lineBounds(p.Line(pos))
+	p.changes = append(p.changes, Change{
+		Rule:    p.rule.rule.Name(),
+		Pos:     p.Fset.Position(pos),
+		Message: message,
+		Edits:   edits,
+		Func:    p.funcName(),
+		Source:  string(bytes.TrimSpace(p.Src[start:end])),
+		rank:    p.rule.rank,
+	})
+}
+
+// funcName returns the name of the top-level function declaration enclosing
+// the node being checked, with its receiver type for methods.
+func (p *Pass) funcName() string {
+	if len(p.funcs) == 0 {
+		return ""
+	}
+	decl, ok := p.funcs[0].node.(*ast.FuncDecl)
+	if !ok {
+		return ""
+	}
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+
+	recv := decl.Recv.List[0].Type
+	pointer := false
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv, pointer = star.X, true
+	}
+	switch x := recv.(type) {
+	case *ast.IndexExpr:
+		recv = x.X
+	case *ast.IndexListExpr:
+		recv = x.X
+	}
+
+	name := "?"
+	if ident, ok := recv.(*ast.Ident); ok {
+		name = ident.Name
+	}
+	if pointer {
+		return "(*" + name + ")." + decl.Name.Name
+	}
+
+	return name + "." + decl.Name.Name
+}
+
+// EnclosingFunc returns the innermost *ast.FuncDecl or *ast.FuncLit enclosing
+// the node being checked, or nil outside of functions.
+func (p *Pass) EnclosingFunc() ast.Node {
+	if len(p.funcs) == 0 {
+		return nil
+	}
+
+	return p.funcs[len(p.funcs)-1].node
+}
+
+// Line returns the line number of pos.
+func (p *Pass) Line(pos token.Pos) int { return p.tokFile.Line(pos) }
+
+// InsertBlankLine returns the edit inserting a blank line above the line of
+// pos. It fails if pos is not the first token on its line. The blank line
+// ends like the line of pos, so that CRLF files keep their line endings.
+func (p *Pass) InsertBlankLine(pos token.Pos) (Edit, bool) {
+	if !p.FirstOnLine(pos) {
+		return Edit{}, false
+	}
+	start, end := p.lineBounds(p.Line(pos))
+
+	text := "\n"
+	if bytes.HasSuffix(p.Src[start:end], []byte("\r\n")) {
+		text = "\r\n"
+	}
+
+	return Edit{Start: start, End: start, Text: text}, true
+}
+
+// DeleteBlankLines returns the edit deleting the lines from..to (inclusive).
+// It fails if any of them is not blank.
+func (p *Pass) DeleteBlankLines(from, to int) (Edit, bool) {
+	if from > to || from < 1 || to > p.tokFile.LineCount() {
+		return Edit{}, false
+	}
+
+	start, _ := p.lineBounds(from)
+	_, end := p.lineBounds(to)
+	if len(bytes.TrimSpace(p.Src[start:end])) != 0 {
+		return Edit{}, false
+	}
+
+	return Edit{Start: start, End: end}, true
+}
+
+// BlankLine reports whether the line consists of whitespace only.
+func (p *Pass) BlankLine(line int) bool {
+	if line < 1 || line > p.tokFile.LineCount() {
+		return false
+	}
+	start, end := p.lineBounds(line)
+
+	return len(bytes.TrimSpace(p.Src[start:end])) == 0
+}
+
+// LastOnLine reports whether only whitespace follows the token ending at end
+// on its line.
+func (p *Pass) LastOnLine(end token.Pos) bool {
+	_, lineEnd := p.lineBounds(p.Line(end))
+
+	return len(bytes.TrimSpace(p.Src[p.tokFile.Offset(end):lineEnd])) == 0
+}
+
+// FirstOnLine reports whether only whitespace precedes pos on its line.
+func (p *Pass) FirstOnLine(pos token.Pos) bool {
+	lineStart, _ := p.lineBounds(p.Line(pos))
+
+	return len(bytes.TrimSpace(p.Src[lineStart:p.tokFile.Offset(pos)])) == 0
+}
+
+// lineBounds returns the offsets of the start of the line and of the start
+// of the next line (or the end of the source for the last line).
+func (p *Pass) lineBounds(line int) (int, int) {
+	start := p.tokFile.Offset(p.tokFile.LineStart(line))
+	end := len(p.Src)
+	if line < p.tokFile.LineCount() {
+		end = p.tokFile.Offset(p.tokFile.LineStart(line + 1))
+	}
+
+	return start, end
+}
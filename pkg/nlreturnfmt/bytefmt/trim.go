@@ -0,0 +1,83 @@
+package bytefmt
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const TrimName = "trim"
+
+// Trim removes blank lines directly after the opening brace and before the
+// closing brace of blocks, such as function bodies and if, for and switch
+// blocks, and directly after the colon of case clauses.
+type Trim struct{}
+
+func NewTrim() *Trim { return &Trim{} }
+
+func (r *Trim) Name() string { return TrimName }
+
+func (r *Trim) Nodes() []ast.Node {
+	return []ast.Node{(*ast.BlockStmt)(nil), (*ast.CaseClause)(nil), (*ast.CommClause)(nil)}
+}
+
+func (r *Trim) Check(p *Pass, c *astutil.Cursor) {
+	switch node := c.Node().(type) {
+	case *ast.BlockStmt:
+		if !r.trimLeading(p, node.Lbrace, node.Rbrace, "{") {
+			r.trimTrailing(p, node.Lbrace, node.Rbrace)
+		}
+	case *ast.CaseClause:
+		if len(node.Body) != 0 {
+			r.trimLeading(p, node.Colon, node.Body[0].Pos(), "case")
+		}
+	case *ast.CommClause:
+		if len(node.Body) != 0 {
+			r.trimLeading(p, node.Colon, node.Body[0].Pos(), "case")
+		}
+	}
+}
+
+// trimLeading removes the blank lines following the line of open, which
+// precede the line of next. It reports whether the whole range was blank.
+func (r *Trim) trimLeading(p *Pass, open, next token.Pos, name string) bool {
+	if !p.LastOnLine(open + 1) {
+		return false
+	}
+
+	from, last := p.Line(open)+1, p.Line(next)
+	to := from
+	for to < last && p.BlankLine(to) {
+		to++
+	}
+	if to == from {
+		return false
+	}
+
+	if edit, ok := p.DeleteBlankLines(from, to-1); ok {
+		p.Report(open, "remove blank lines after "+name, edit)
+	}
+
+	return to == last
+}
+
+// trimTrailing removes the blank lines preceding the line of the closing brace.
+func (r *Trim) trimTrailing(p *Pass, open, rbrace token.Pos) {
+	if !rbrace.IsValid() || !p.FirstOnLine(rbrace) {
+		return
+	}
+
+	first, to := p.Line(open), p.Line(rbrace)-1
+	from := to
+	for from > first && p.BlankLine(from) {
+		from--
+	}
+	if from == to {
+		return
+	}
+
+	if edit, ok := p.DeleteBlankLines(from+1, to); ok {
+		p.Report(rbrace, "remove blank lines before }", edit)
+	}
+}
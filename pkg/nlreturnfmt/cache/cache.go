@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const dirName = "nlreturnfmt"
+
+type (
+	// Cache remembers the content hashes of files that are known to be already
+	// formatted, so they can be skipped without parsing on subsequent runs.
+	// Entries are never evicted and the cache has no size limit, see Clean.
+	Cache struct {
+		dir  string
+		salt string
+	}
+)
+
+// Dir returns the default cache directory under the user cache dir.
+func Dir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir: %w", err)
+	}
+
+	return filepath.Join(dir, dirName), nil
+}
+
+// New returns a cache stored in dir. The salt must identify everything besides
+// the file content that affects the result, such as the tool version and the
+// formatting options.
+func New(dir, salt string) *Cache {
+	return &Cache{
+		dir:  dir,
+		salt: salt,
+	}
+}
+
+// Has reports whether src is known to be formatted.
+func (c *Cache) Has(src []byte) bool {
+	_, err := os.Stat(c.path(src))
+
+	return err == nil
+}
+
+// Put records that src is formatted.
+func (c *Cache) Put(src []byte) error {
+	path := c.path(src)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	return nil
+}
+
+// Clean removes all cache entries.
+func (c *Cache) Clean() error {
+	if err := os.RemoveAll(c.dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("os.RemoveAll: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) path(src []byte) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(c.salt))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(src)
+	key := hex.EncodeToString(h.Sum(nil))
+
+	return filepath.Join(c.dir, key[:2], key)
+}
@@ -0,0 +1,28 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	src := []byte("package main\n")
+
+	sut := cache.New(dir, "v1 block-size=1")
+	assert.False(t, sut.Has(src))
+
+	require.NoError(t, sut.Put(src))
+	assert.True(t, sut.Has(src))
+	assert.False(t, sut.Has([]byte("package other\n")), "different content must not hit")
+	assert.False(t, cache.New(dir, "v1 block-size=2").Has(src), "different options must not hit")
+	assert.False(t, cache.New(dir, "v2 block-size=1").Has(src), "different version must not hit")
+
+	require.NoError(t, sut.Clean())
+	assert.False(t, sut.Has(src))
+	require.NoError(t, sut.Clean(), "cleaning a missing cache is not an error")
+}
@@ -4,12 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"iter"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/baseline"
 	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/cache"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/mdfmt"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -23,7 +31,21 @@ type (
 		dryRun      bool
 		verbose     bool
 		parallelism int
+		markdown    bool // Also format Markdown documents found in directories.
+		rules       []bytefmt.Rule
+		bytefmtOpts []bytefmt.Option
 		bytefmt     *bytefmt.Formatter
+		mu          sync.Mutex
+		// lineRanges returns the line ranges to format in a file,
+		// nil for the whole file.
+		lineRanges func(filename string) []bytefmt.LineRange
+		baseline   *baseline.Baseline // Known violations to suppress.
+		record     *baseline.Baseline // Collects violations instead of fixing them.
+		modified   atomic.Int64
+
+		cacheDir     string
+		cacheVersion string
+		cache        *cache.Cache
 	}
 )
 
@@ -35,7 +57,13 @@ func New(opts ...Option) *Formatter {
 	for _, opt := range opts {
 		opt(f)
 	}
-	f.bytefmt = bytefmt.New(f.blockSize)
+	if len(f.rules) == 0 {
+		f.rules = []bytefmt.Rule{&bytefmt.NLReturn{BlockSize: f.blockSize}}
+	}
+	f.bytefmt = bytefmt.New(append(f.bytefmtOpts, bytefmt.WithRules(f.rules...))...)
+	if f.cacheDir != "" {
+		f.cache = cache.New(f.cacheDir, f.cacheVersion+"\x00"+f.bytefmt.Fingerprint())
+	}
 
 	return f
 }
@@ -45,7 +73,19 @@ func (f *Formatter) FormatFile(ctx context.Context, filename string, src []byte)
 		return nil, false, err
 	}
 
-	res, err := f.bytefmt.Format(filename, src)
+	return f.FormatFileRange(ctx, filename, src, f.ranges(filename))
+}
+
+// FormatFileRange formats only the statements within the given line ranges,
+// see bytefmt.Formatter.FormatRange.
+func (f *Formatter) FormatFileRange(
+	ctx context.Context, filename string, src []byte, ranges []bytefmt.LineRange,
+) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	res, err := f.format(filename, src, ranges)
 	if err != nil {
 		return nil, false, fmt.Errorf("format: %w", err)
 	}
@@ -53,76 +93,165 @@ func (f *Formatter) FormatFile(ctx context.Context, filename string, src []byte)
 	return res.Value, res.Modified, nil
 }
 
-func (f *Formatter) FormatPath(ctx context.Context, path string) error {
-	info, err := os.Stat(path)
+// FormatFragment is like FormatFile, but src may also be a declaration list
+// or a statement list, e.g. an editor selection piped to stdin, see
+// bytefmt.Formatter.FormatFragment.
+func (f *Formatter) FormatFragment(ctx context.Context, filename string, src []byte) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	if isMarkdown(filename) {
+		return f.FormatFile(ctx, filename, src)
+	}
+
+	res, err := f.bytefmt.FormatFragment(filename, src, f.ranges(filename))
 	if err != nil {
-		return fmt.Errorf("os.Stat: %w", err)
+		return nil, false, fmt.Errorf("format: %w", err)
 	}
 
-	if info.IsDir() {
-		return f.processDir(ctx, path)
+	return res.Value, res.Modified, nil
+}
+
+// format formats a Go file, or the Go code blocks of a Markdown document.
+func (f *Formatter) format(filename string, src []byte, ranges []bytefmt.LineRange) (bytefmt.Result, error) {
+	if isMarkdown(filename) {
+		return mdfmt.FormatRange(f.documentFormatter(), filename, src, ranges)
 	}
 
-	return f.processFile(ctx, path)
+	return f.bytefmt.FormatRange(filename, src, ranges)
 }
 
-func (f *Formatter) processDir(ctx context.Context, dir string) error {
-	g, ctx := errgroup.WithContext(ctx)
-	g.SetLimit(f.parallelism)
+// documentFormatter returns the formatter for the code blocks of a Markdown
+// document. Blocks are formatted one by one, so known violations are counted
+// by a baseline filter shared by the blocks of the document.
+func (f *Formatter) documentFormatter() *bytefmt.Formatter {
+	if f.baseline == nil {
+		return f.bytefmt
+	}
+
+	return bytefmt.New(append(slices.Clone(f.bytefmtOpts),
+		bytefmt.WithRules(f.rules...), bytefmt.WithFilter(f.baseline.NewFilter()))...)
+}
 
-	resch := make(chan bytefmt.Result, f.parallelism)
+func isMarkdown(filename string) bool { return strings.HasSuffix(filename, ".md") }
 
-	processFile := func(filename string) error {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
+// ModifiedFiles returns the number of files processed so far that needed
+// changes, whether or not they were written.
+func (f *Formatter) ModifiedFiles() int { return int(f.modified.Load()) }
 
-		src, err := os.ReadFile(filename)
-		if err != nil {
-			return fmt.Errorf("os.ReadFile: %w", err)
-		}
+func (f *Formatter) FormatPath(ctx context.Context, path string) error {
+	return f.FormatPaths(ctx, path)
+}
 
-		g.Go(func() error {
-			res, innerr := f.bytefmt.Format(filename, src)
-			if innerr != nil {
-				return fmt.Errorf("format: %w", innerr)
+// FormatPaths formats files and directories. All of them feed one shared
+// worker pool, so passing many files at once is as parallel as a directory walk.
+func (f *Formatter) FormatPaths(ctx context.Context, paths ...string) error {
+	return f.process(ctx, func(fn func(string) error) error {
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("os.Stat: %w", err)
 			}
 
-			select {
-			case <-ctx.Done():
-			case resch <- res:
+			if !info.IsDir() {
+				if err = fn(path); err != nil {
+					return err
+				}
+
+				continue
 			}
 
-			return nil
-		})
+			err = filepath.WalkDir(path, func(path string, info fs.DirEntry, err error) error {
+				return f.processDirWalk(path, info, err, fn)
+			})
+			if err != nil {
+				return err
+			}
+		}
 
 		return nil
-	}
+	})
+}
+
+// FormatFiles formats every file yielded by filenames. Files are processed
+// by the same worker pool as directories, so long lists (e.g. from pre-commit)
+// are formatted in parallel. Unlike directory walks, no filtering is applied.
+func (f *Formatter) FormatFiles(ctx context.Context, filenames iter.Seq[string]) error {
+	return f.process(ctx, func(fn func(string) error) error {
+		for filename := range filenames {
+			if err := fn(filename); err != nil {
+				return err
+			}
+		}
 
+		return nil
+	})
+}
+
+// process runs the formatting pipeline: produce sends file names into a
+// bounded queue and a fixed number of workers read, format and write each
+// file. Nothing is buffered between stages, so at most parallelism files are
+// held in memory and a slow consumer applies backpressure to the walk.
+//
+// A file produced more than once, e.g. passed both directly and inside a
+// directory, is queued only once, so that workers never write it concurrently.
+func (f *Formatter) process(ctx context.Context, produce func(fn func(string) error) error) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	filenames := make(chan string, f.parallelism)
 	g.Go(func() error {
-		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			return f.processDirWalk(path, info, err, processFile)
+		defer close(filenames)
+
+		seen := make(map[string]struct{})
+
+		return produce(func(filename string) error {
+			key, err := filepath.Abs(filename)
+			if err != nil {
+				return fmt.Errorf("filepath.Abs: %w", err)
+			}
+			if _, ok := seen[key]; ok {
+				return nil
+			}
+			seen[key] = struct{}{}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case filenames <- filename:
+				return nil
+			}
 		})
 	})
-	go func() {
-		defer close(resch)
 
-		_ = g.Wait()
-	}()
+	var (
+		mu   sync.Mutex
+		errs error
+	)
+	for range f.parallelism {
+		g.Go(func() error {
+			for filename := range filenames {
+				if err := f.processFile(ctx, filename); err != nil {
+					var resErr *resultError
+					if !errors.As(err, &resErr) {
+						return err
+					}
+
+					mu.Lock()
+					errs = errors.Join(errs, err)
+					mu.Unlock()
+				}
+			}
 
-	var errs error
-	for res := range resch {
-		if err := f.processFileResult(res); err != nil {
-			errs = errors.Join(errs, fmt.Errorf("processFileResult: %w", err))
-		}
+			return nil
+		})
 	}
 
 	return errors.Join(errs, g.Wait())
 }
 
-func (f *Formatter) processDirWalk(path string, info os.FileInfo, err error, fn func(string) error) error {
+func (f *Formatter) processDirWalk(path string, info fs.DirEntry, err error, fn func(string) error) error {
 	if err != nil {
-		return fmt.Errorf("filepath.Walk: %w", err)
+		return fmt.Errorf("filepath.WalkDir: %w", err)
 	}
 	name := info.Name()
 
@@ -140,7 +269,7 @@ func (f *Formatter) processDirWalk(path string, info os.FileInfo, err error, fn
 				return nil
 			}
 		case strings.HasSuffix(name, "_test.go"):
-		case strings.HasSuffix(name, ".go"):
+		case strings.HasSuffix(name, ".go"), f.markdown && isMarkdown(name):
 			if err = fn(path); err != nil {
 				return err
 			}
@@ -150,12 +279,20 @@ func (f *Formatter) processDirWalk(path string, info os.FileInfo, err error, fn
 	}()
 
 	if errors.Is(err, filepath.SkipDir) && f.verbose {
-		fmt.Printf("%s skipped\n", path)
+		f.printf("%s skipped\n", path)
 	}
 
 	return err
 }
 
+// resultError reports a failure to handle a formatted file. Unlike read and
+// parse errors, it does not stop the remaining files from being processed.
+type resultError struct{ err error }
+
+func (e *resultError) Error() string { return "processFileResult: " + e.err.Error() }
+
+func (e *resultError) Unwrap() error { return e.err }
+
 func (f *Formatter) processFile(ctx context.Context, filename string) error {
 	if err := ctx.Err(); err != nil {
 		return err
@@ -166,38 +303,76 @@ func (f *Formatter) processFile(ctx context.Context, filename string) error {
 		return fmt.Errorf("os.ReadFile: %w", err)
 	}
 
-	res, err := f.bytefmt.Format(filename, src)
-	if err != nil {
-		return fmt.Errorf("format: %w", err)
+	ranges := f.ranges(filename)
+	cached := f.cache != nil && f.cache.Has(src)
+	res := bytefmt.Result{Filename: filename, Value: src}
+	if !cached {
+		if res, err = f.format(filename, src, ranges); err != nil {
+			return fmt.Errorf("format: %w", err)
+		}
+	}
+
+	if f.record != nil {
+		f.record.Add(res.Changes)
+	} else {
+		if err = f.processFileResult(res); err != nil {
+			return &resultError{err: err}
+		}
+		if res.Modified {
+			f.modified.Add(1)
+		}
 	}
 
-	if err = f.processFileResult(res); err != nil {
-		return fmt.Errorf("processFileResult: %w", err)
+	// A file formatted within ranges or with known violations suppressed may
+	// still need changes elsewhere.
+	if f.cache != nil && !cached && ranges == nil && f.baseline == nil {
+		switch {
+		case !res.Modified:
+			_ = f.cache.Put(src) // The cache is best effort.
+		case f.write && !f.dryRun:
+			_ = f.cache.Put(res.Value)
+		}
 	}
 
 	return nil
 }
 
+func (f *Formatter) ranges(filename string) []bytefmt.LineRange {
+	if f.lineRanges == nil {
+		return nil
+	}
+
+	return f.lineRanges(filename)
+}
+
 func (f *Formatter) processFileResult(res bytefmt.Result) error {
 	switch {
 	case !res.Modified && f.verbose:
-		fmt.Printf("%s: no changes needed\n", res.Filename)
+		f.printf("%s: no changes needed\n", res.Filename)
 	case !res.Modified:
 	case f.dryRun && f.verbose:
-		fmt.Printf("%s: would be modified\n%s", res.Filename, res.Details)
+		f.printf("%s: would be modified\n%s", res.Filename, res.Details)
 	case f.dryRun:
-		fmt.Printf("%s: would be modified\n", res.Filename)
+		f.printf("%s: would be modified\n", res.Filename)
 	case f.write:
 		if f.verbose {
-			fmt.Printf("%s: formatted\n%s", res.Filename, res.Details)
+			f.printf("%s: formatted\n%s", res.Filename, res.Details)
 		}
 		//nolint: gosec
 		if err := os.WriteFile(res.Filename, res.Value, 0o644); err != nil {
 			return fmt.Errorf("os.WriteFile: %w", err)
 		}
 	default:
-		fmt.Printf("// %s - formatted:\n%s\n", res.Filename, string(res.Value))
+		f.printf("// %s - formatted:\n%s\n", res.Filename, string(res.Value))
 	}
 
 	return nil
 }
+
+// printf writes to stdout so that output of concurrent workers does not interleave.
+func (f *Formatter) printf(format string, args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Printf(format, args...)
+}
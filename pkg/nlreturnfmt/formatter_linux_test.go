@@ -0,0 +1,44 @@
+package nlreturnfmt_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	benchTreeFiles       = 50_000
+	benchTreeFilesPerDir = 500
+)
+
+// BenchmarkFormatter_FormatPaths_LargeTree walks a generated tree of
+// benchTreeFiles files and reports the peak RSS of the process.
+func BenchmarkFormatter_FormatPaths_LargeTree(b *testing.B) {
+	src := read(b, "../../testdata/p/p.golden.go")
+
+	dir := b.TempDir()
+	for i := range benchTreeFiles {
+		sub := filepath.Join(dir, fmt.Sprintf("pkg%03d", i/benchTreeFilesPerDir))
+		if i%benchTreeFilesPerDir == 0 {
+			require.NoError(b, os.Mkdir(sub, 0o755))
+		}
+		require.NoError(b, os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%05d.go", i)), src, 0o600))
+	}
+
+	sut := nlreturnfmt.New(nlreturnfmt.WithWrite())
+
+	for b.Loop() {
+		require.NoError(b, sut.FormatPath(b.Context(), dir))
+	}
+
+	var usage syscall.Rusage
+	require.NoError(b, syscall.Getrusage(syscall.RUSAGE_SELF, &usage))
+	b.ReportMetric(float64(usage.Maxrss)/1024, "peak-rss-MB") // Maxrss is in KiB on Linux.
+	b.ReportMetric(float64(benchTreeFiles*b.N)/b.Elapsed().Seconds(), "files/s")
+}
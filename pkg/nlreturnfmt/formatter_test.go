@@ -1,13 +1,20 @@
 package nlreturnfmt_test
 
 import (
+	"go/ast"
+	"go/token"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/baseline"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/cache"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/ast/astutil"
 )
 
 func TestFormatter_FormatBytes(t *testing.T) {
@@ -15,6 +22,7 @@ func TestFormatter_FormatBytes(t *testing.T) {
 		name      string
 		input     string
 		blockSize int
+		opts      []nlreturnfmt.Option
 		want      string
 		wantErr   bool
 	}{
@@ -56,6 +64,188 @@ func TestFormatter_FormatBytes(t *testing.T) {
 			input:     "../../testdata/comments/comments.go",
 			want:      "../../testdata/comments/comments.go",
 		},
+		{
+			name:  "kind return",
+			opts:  kindOpts(token.RETURN),
+			input: "../../testdata/kinds/kinds.input.go",
+			want:  "../../testdata/kinds/kinds.return.golden.go",
+		},
+		{
+			name:  "kind break",
+			opts:  kindOpts(token.BREAK),
+			input: "../../testdata/kinds/kinds.input.go",
+			want:  "../../testdata/kinds/kinds.break.golden.go",
+		},
+		{
+			name:  "kind continue",
+			opts:  kindOpts(token.CONTINUE),
+			input: "../../testdata/kinds/kinds.input.go",
+			want:  "../../testdata/kinds/kinds.continue.golden.go",
+		},
+		{
+			name:  "kind goto",
+			opts:  kindOpts(token.GOTO),
+			input: "../../testdata/kinds/kinds.input.go",
+			want:  "../../testdata/kinds/kinds.goto.golden.go",
+		},
+		{
+			name:  "kind fallthrough",
+			opts:  kindOpts(token.FALLTHROUGH),
+			input: "../../testdata/kinds/kinds.input.go",
+			want:  "../../testdata/kinds/kinds.fallthrough.golden.go",
+		},
+		{
+			name:      "labels",
+			blockSize: 1,
+			input:     "../../testdata/labels/labels.input.go",
+			want:      "../../testdata/labels/labels.golden.go",
+		},
+		{
+			name: "terminating calls",
+			opts: []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{
+				BlockSize:        1,
+				TerminatingCalls: append(bytefmt.DefaultTerminatingCalls(), "mylog.Die"),
+			})},
+			input: "../../testdata/terminating/terminating.input.go",
+			want:  "../../testdata/terminating/terminating.golden.go",
+		},
+		{
+			name:  "strict",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{BlockSize: 2, Strict: true})},
+			input: "../../testdata/strict/strict.input.go",
+			want:  "../../testdata/strict/strict.golden.go",
+		},
+		{
+			name:  "strict idempotent",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{BlockSize: 2, Strict: true})},
+			input: "../../testdata/strict/strict.golden.go",
+			want:  "../../testdata/strict/strict.golden.go",
+		},
+		{
+			name:  "measure lines",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{BlockSize: 2, Measure: bytefmt.MeasureLines})},
+			input: "../../testdata/measure/measure.input.go",
+			want:  "../../testdata/measure/measure.lines.golden.go",
+		},
+		{
+			name: "measure statements",
+			opts: []nlreturnfmt.Option{
+				nlreturnfmt.WithRules(&bytefmt.NLReturn{BlockSize: 2, Measure: bytefmt.MeasureStatements}),
+			},
+			input: "../../testdata/measure/measure.input.go",
+			want:  "../../testdata/measure/measure.statements.golden.go",
+		},
+		{
+			name:  "cuddle assign",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{BlockSize: 1, CuddleAssign: 1})},
+			input: "../../testdata/cuddle/cuddle.input.go",
+			want:  "../../testdata/cuddle/cuddle.golden.go",
+		},
+		{
+			name:  "block end",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(bytefmt.NewBlockEnd())},
+			input: "../../testdata/blockend/blockend.input.go",
+			want:  "../../testdata/blockend/blockend.golden.go",
+		},
+		{
+			name:  "defer and go",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(bytefmt.NewDeferGo())},
+			input: "../../testdata/defergo/defergo.input.go",
+			want:  "../../testdata/defergo/defergo.golden.go",
+		},
+		{
+			name:  "trim",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(bytefmt.NewTrim())},
+			input: "../../testdata/trim/trim.input.go",
+			want:  "../../testdata/trim/trim.golden.go",
+		},
+		{
+			name:  "case separation enforced",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(bytefmt.NewCaseSep())},
+			input: "../../testdata/casesep/casesep.input.go",
+			want:  "../../testdata/casesep/casesep.enforce.golden.go",
+		},
+		{
+			name:  "case separation forbidden",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.CaseSep{Forbid: true, MinLines: 2})},
+			input: "../../testdata/casesep/casesep.input.go",
+			want:  "../../testdata/casesep/casesep.forbid.golden.go",
+		},
+		{
+			name:  "max blank lines with nlreturn",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithRules(bytefmt.NewNLReturn(), bytefmt.NewMaxBlank())},
+			input: "../../testdata/maxblank/maxblank.input.go",
+			want:  "../../testdata/maxblank/maxblank.golden.go",
+		},
+		{
+			name: "max blank lines in short funcs",
+			opts: []nlreturnfmt.Option{
+				nlreturnfmt.WithRules(bytefmt.NewMaxBlank()),
+				nlreturnfmt.WithShortFuncs(6, bytefmt.MeasureLines),
+			},
+			input: "../../testdata/maxblank/maxblank.short.input.go",
+			want:  "../../testdata/maxblank/maxblank.short.golden.go",
+		},
+		{
+			name:  "short funcs in lines",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithShortFuncs(4, bytefmt.MeasureLines)},
+			input: "../../testdata/shortfuncs/shortfuncs.input.go",
+			want:  "../../testdata/shortfuncs/shortfuncs.golden.go",
+		},
+		{
+			name:  "short funcs in statements",
+			opts:  []nlreturnfmt.Option{nlreturnfmt.WithShortFuncs(3, bytefmt.MeasureStatements)},
+			input: "../../testdata/shortfuncs/shortfuncs.input.go",
+			want:  "../../testdata/shortfuncs/shortfuncs.golden.go",
+		},
+		{
+			name:  "func lit block size",
+			opts:  funcLitOpts(1, 2),
+			input: "../../testdata/funclit/funclit.input.go",
+			want:  "../../testdata/funclit/funclit.blocksize.golden.go",
+		},
+		{
+			name:  "func lit block size zero",
+			opts:  funcLitOpts(10, 0),
+			input: "../../testdata/funclit/funclit.input.go",
+			want:  "../../testdata/funclit/funclit.zero.golden.go",
+		},
+		{
+			name: "func lit disabled",
+			opts: []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{
+				BlockSize: 1,
+				FuncLit:   bytefmt.Scope{Disabled: true},
+			})},
+			input: "../../testdata/funclit/funclit.input.go",
+			want:  "../../testdata/funclit/funclit.disabled.golden.go",
+		},
+		{
+			name: "line ranges",
+			opts: []nlreturnfmt.Option{
+				nlreturnfmt.WithBlockSize(1),
+				nlreturnfmt.WithLineRanges(bytefmt.LineRange{Start: 3, End: 7}, bytefmt.LineRange{Start: 20, End: 21}),
+			},
+			input: "../../testdata/ranges/ranges.input.go",
+			want:  "../../testdata/ranges/ranges.golden.go",
+		},
+		{
+			name:      "markdown",
+			blockSize: 1,
+			input:     "../../testdata/markdown/markdown.input.md",
+			want:      "../../testdata/markdown/markdown.golden.md",
+		},
+		{
+			name:      "crlf line endings",
+			blockSize: 1,
+			input:     "../../testdata/crlf/crlf.input.go",
+			want:      "../../testdata/crlf/crlf.golden.go",
+		},
+		{
+			name:      "not gofmt normalized",
+			blockSize: 1,
+			input:     "../../testdata/unformatted/unformatted.input.go",
+			want:      "../../testdata/unformatted/unformatted.golden.go",
+		},
 		{
 			name:      "syntax error",
 			blockSize: 1,
@@ -69,7 +259,12 @@ func TestFormatter_FormatBytes(t *testing.T) {
 			input := read(t, tt.input)
 			want := read(t, tt.want)
 
-			sut := nlreturnfmt.New(nlreturnfmt.WithBlockSize(tt.blockSize))
+			opts := tt.opts
+			if opts == nil {
+				opts = []nlreturnfmt.Option{nlreturnfmt.WithBlockSize(tt.blockSize)}
+			}
+
+			sut := nlreturnfmt.New(opts...)
 			got, _, err := sut.FormatFile(t.Context(), tt.input, input)
 
 			if tt.wantErr {
@@ -82,7 +277,75 @@ func TestFormatter_FormatBytes(t *testing.T) {
 	}
 }
 
-func read(t *testing.T, filename string) []byte {
+func TestFormatter_FormatFragment(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "file",
+			input: "package p\n\nfunc f() {\n\tprintln()\n\treturn\n}\n",
+			want:  "package p\n\nfunc f() {\n\tprintln()\n\n\treturn\n}\n",
+		},
+		{
+			name:  "declaration list",
+			input: "func f() {\n\tprintln()\n\treturn\n}\n\nfunc g() {}\n",
+			want:  "func f() {\n\tprintln()\n\n\treturn\n}\n\nfunc g() {}\n",
+		},
+		{
+			name:  "statement list",
+			input: "for {\n\tprintln()\n\tbreak\n}\nprintln()\nreturn\n",
+			want:  "for {\n\tprintln()\n\n\tbreak\n}\nprintln()\n\nreturn\n",
+		},
+		{
+			name:  "indented statement list without trailing newline",
+			input: "\t\tprintln()\n\t\treturn",
+			want:  "\t\tprintln()\n\n\t\treturn",
+		},
+		{
+			// Like gofmt, blank lines around a fragment are kept.
+			name:  "statement list with surrounding blank lines",
+			input: "\n\tprintln()\n\treturn\n\n",
+			want:  "\n\tprintln()\n\n\treturn\n\n",
+		},
+		{
+			name:    "invalid",
+			input:   "func ... {\n\treturn\n}\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := nlreturnfmt.New(nlreturnfmt.WithRules(bytefmt.NewNLReturn(), bytefmt.NewTrim()))
+			got, _, err := sut.FormatFragment(t.Context(), "<stdin>", []byte(tt.input))
+
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func kindOpts(kinds ...token.Token) []nlreturnfmt.Option {
+	return []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{BlockSize: 1, Kinds: kinds})}
+}
+
+// funcLitOpts sets a block size for function literals other than the rule's.
+func funcLitOpts(blockSize, funcLitBlockSize int) []nlreturnfmt.Option {
+	return []nlreturnfmt.Option{nlreturnfmt.WithRules(&bytefmt.NLReturn{
+		BlockSize: blockSize,
+		FuncLit:   bytefmt.Scope{BlockSize: &funcLitBlockSize},
+	})}
+}
+
+func read(t testing.TB, filename string) []byte {
 	if filename == "" {
 		return nil
 	}
@@ -92,3 +355,135 @@ func read(t *testing.T, filename string) []byte {
 
 	return content
 }
+
+func TestFormatter_FormatPaths(t *testing.T) {
+	input := read(t, "../../testdata/p/p.input.go")
+	golden := read(t, "../../testdata/p/p.golden.go")
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+
+	files := []string{
+		filepath.Join(dir, "a.go"),
+		filepath.Join(dir, "b.go"),
+		filepath.Join(sub, "c.go"),
+	}
+	for _, file := range files {
+		require.NoError(t, os.WriteFile(file, input, 0o600))
+	}
+
+	sut := nlreturnfmt.New(nlreturnfmt.WithWrite(), nlreturnfmt.WithParallelism(2))
+	require.NoError(t, sut.FormatPaths(t.Context(), files[0], files[1], sub))
+
+	for _, file := range files {
+		assert.Equal(t, string(golden), string(read(t, file)), "file %s is not formatted", file)
+	}
+}
+
+func TestFormatter_FormatPaths_Duplicates(t *testing.T) {
+	input := read(t, "../../testdata/p/p.input.go")
+	golden := read(t, "../../testdata/p/p.golden.go")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "p.go")
+	require.NoError(t, os.WriteFile(file, input, 0o600))
+
+	paths := []string{file, dir, filepath.Join(dir, ".", "p.go"), file}
+
+	sut := nlreturnfmt.New(nlreturnfmt.WithDryRun(), nlreturnfmt.WithParallelism(4))
+	require.NoError(t, sut.FormatPaths(t.Context(), paths...))
+	assert.Equal(t, 1, sut.ModifiedFiles(), "a file passed several times must be processed once")
+
+	sut = nlreturnfmt.New(nlreturnfmt.WithWrite(), nlreturnfmt.WithParallelism(4))
+	require.NoError(t, sut.FormatPaths(t.Context(), paths...))
+	assert.Equal(t, string(golden), string(read(t, file)))
+}
+
+func TestFormatter_FormatPaths_BaselineMarkdown(t *testing.T) {
+	const fence = "```go\nprintln()\nreturn\n```\n\n"
+
+	root := t.TempDir()
+	file := filepath.Join(root, "doc.md")
+	require.NoError(t, os.WriteFile(file, []byte("# Doc\n\n"+fence+fence), 0o600))
+
+	b := baseline.New(root)
+	require.NoError(t, nlreturnfmt.New(nlreturnfmt.WithBaselineUpdate(b)).FormatPaths(t.Context(), file))
+
+	sut := nlreturnfmt.New(nlreturnfmt.WithDryRun(), nlreturnfmt.WithBaseline(b))
+	require.NoError(t, sut.FormatPaths(t.Context(), file))
+	assert.Equal(t, 0, sut.ModifiedFiles(), "known violations must be suppressed")
+
+	// Known violations are counted per document, not per code block.
+	require.NoError(t, os.WriteFile(file, []byte("# Doc\n\n"+fence+fence+fence), 0o600))
+	sut = nlreturnfmt.New(nlreturnfmt.WithDryRun(), nlreturnfmt.WithBaseline(b))
+	require.NoError(t, sut.FormatPaths(t.Context(), file))
+	assert.Equal(t, 1, sut.ModifiedFiles(), "the third code block is a new violation")
+}
+
+func TestFormatter_FormatPaths_Cache(t *testing.T) {
+	input := read(t, "../../testdata/p/p.input.go")
+	golden := read(t, "../../testdata/p/p.golden.go")
+
+	cacheDir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "p.go")
+	require.NoError(t, os.WriteFile(file, input, 0o600))
+
+	// Pretend the unformatted input was recorded as formatted by a previous run.
+	salt := "v1\x00" + bytefmt.New(bytefmt.WithRules(&bytefmt.NLReturn{BlockSize: 1})).Fingerprint()
+	require.NoError(t, cache.New(cacheDir, salt).Put(input))
+
+	sut := nlreturnfmt.New(nlreturnfmt.WithWrite(), nlreturnfmt.WithCache(cacheDir, "v1"))
+	require.NoError(t, sut.FormatPath(t.Context(), file))
+	assert.Equal(t, string(input), string(read(t, file)), "cached file must be skipped")
+
+	sut = nlreturnfmt.New(nlreturnfmt.WithWrite(), nlreturnfmt.WithCache(cacheDir, "v2"))
+	require.NoError(t, sut.FormatPath(t.Context(), file))
+	assert.Equal(t, string(golden), string(read(t, file)), "cache of another version must be ignored")
+	assert.True(t, cache.New(cacheDir, "v2\x00"+bytefmt.New(bytefmt.WithRules(&bytefmt.NLReturn{BlockSize: 1})).Fingerprint()).Has(golden))
+}
+
+func TestFormatter_Fingerprint(t *testing.T) {
+	fingerprint := func(funcLitBlockSize int) string {
+		return bytefmt.New(bytefmt.WithRules(&bytefmt.NLReturn{
+			FuncLit: bytefmt.Scope{BlockSize: &funcLitBlockSize},
+		})).Fingerprint()
+	}
+
+	assert.Equal(t, fingerprint(0), fingerprint(0), "scope block sizes must be keyed by value")
+	assert.NotEqual(t, fingerprint(0), fingerprint(2))
+	assert.NotEqual(t, fingerprint(0), bytefmt.New(bytefmt.WithRules(&bytefmt.NLReturn{})).Fingerprint())
+}
+
+// blankBeforeReturn inserts the same blank lines as nlreturn, but before every return.
+type blankBeforeReturn struct{}
+
+func (blankBeforeReturn) Name() string { return "blank-before-return" }
+
+func (blankBeforeReturn) Nodes() []ast.Node { return []ast.Node{(*ast.ReturnStmt)(nil)} }
+
+func (blankBeforeReturn) Check(p *bytefmt.Pass, c *astutil.Cursor) {
+	if edit, ok := p.InsertBlankLine(c.Node().Pos()); ok {
+		p.Report(c.Node().Pos(), "insert blank line before return", edit)
+	}
+}
+
+func TestFormatter_Rules(t *testing.T) {
+	input := read(t, "../../testdata/branches/branches.input.go")
+	golden := read(t, "../../testdata/branches/branches.golden.go")
+
+	sut := bytefmt.New(bytefmt.WithRules(bytefmt.NewNLReturn(), blankBeforeReturn{}))
+	res, err := sut.Format("branches.go", input)
+	require.NoError(t, err)
+
+	assert.Equal(t, string(golden), string(res.Value))
+	require.Len(t, res.Changes, 2)
+	for _, change := range res.Changes {
+		assert.Equal(t, bytefmt.NLReturnName, change.Rule)
+	}
+	assert.Equal(t, "insert blank line before continue", res.Changes[0].Message)
+	assert.Equal(t, 7, res.Changes[0].Pos.Line)
+
+	_, err = bytefmt.NewRule("unknown")
+	require.Error(t, err)
+}
@@ -0,0 +1,248 @@
+// Package git reads changes and staged files from the local git repository,
+// so that only modified lines or the index are formatted.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+)
+
+// Changes maps absolute file names to the lines added or modified in them.
+type Changes map[string][]bytefmt.LineRange
+
+// Ranges returns the changed lines of filename. Files without changes get
+// empty non-nil ranges, so that they are left alone rather than formatted whole.
+func (c Changes) Ranges(filename string) []bytefmt.LineRange {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return []bytefmt.LineRange{}
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	if ranges, ok := c[abs]; ok {
+		return ranges
+	}
+
+	return []bytefmt.LineRange{}
+}
+
+// Files returns the sorted names of the changed files.
+func (c Changes) Files() []string {
+	files := make([]string, 0, len(c))
+	for file := range c {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	return files
+}
+
+// Root returns the top-level directory of the repository containing dir.
+func Root(ctx context.Context, dir string) (string, error) {
+	out, err := run(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	root := strings.TrimSpace(string(out))
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	return root, nil
+}
+
+// Diff returns the lines of the working tree added or modified since the
+// merge base of base and HEAD, so that commits made on base after branching
+// off are not reported. Only the local repository is used.
+func Diff(ctx context.Context, dir, base string) (Changes, error) {
+	root, err := Root(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := run(ctx, root, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	mergeBase := strings.TrimSpace(string(out))
+
+	out, err = run(ctx, root, "diff", "--no-color", "--no-ext-diff", "--no-renames",
+		"--src-prefix=a/", "--dst-prefix=b/", "-U0", mergeBase, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDiff(root, out)
+}
+
+// ParseDiff parses the output of git diff -U0 into the changed lines of every
+// file, file names are resolved relative to root. Files whose changes are
+// deletions only are omitted.
+func ParseDiff(root string, diff []byte) (Changes, error) {
+	changes := make(Changes)
+
+	var file string
+	sc := bufio.NewScanner(bytes.NewReader(diff))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = ""
+			if name, ok := diffName(line[len("+++ "):]); ok {
+				file = filepath.Join(root, filepath.FromSlash(name))
+			}
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			r, ok, err := parseHunk(line)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				changes[file] = append(changes[file], r)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("bufio.Scanner: %w", err)
+	}
+
+	return changes, nil
+}
+
+// diffName returns the file name of a "+++ b/name" line of git diff. Git
+// appends a tab to names containing spaces and quotes names with special
+// characters, e.g. "b/\303\251.go". It reports false for /dev/null.
+func diffName(s string) (string, bool) {
+	s = strings.TrimSuffix(s, "\t")
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return "", false
+		}
+		s = unquoted
+	}
+
+	return strings.CutPrefix(s, "b/")
+}
+
+// parseHunk parses the new side of a hunk header "@@ -a,b +c,d @@". It
+// reports false for hunks that only delete lines.
+func parseHunk(line string) (bytefmt.LineRange, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return bytefmt.LineRange{}, false, fmt.Errorf("invalid hunk header %q", line)
+	}
+
+	startStr, countStr, hasCount := strings.Cut(fields[2][1:], ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return bytefmt.LineRange{}, false, fmt.Errorf("invalid hunk header %q: %w", line, err)
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return bytefmt.LineRange{}, false, fmt.Errorf("invalid hunk header %q: %w", line, err)
+		}
+	}
+	if count == 0 {
+		return bytefmt.LineRange{}, false, nil
+	}
+
+	return bytefmt.LineRange{Start: start, End: start + count - 1}, true, nil
+}
+
+// StagedFile is a file added or modified in the index.
+type StagedFile struct {
+	Path   string // Slash separated, relative to the repository root.
+	Mode   string
+	Object string // Id of the staged blob.
+}
+
+// Staged returns the files added or modified in the index of the repository
+// at root, compared to HEAD.
+func Staged(ctx context.Context, root string) ([]StagedFile, error) {
+	out, err := run(ctx, root, "diff", "--cached", "--raw", "-z", "--no-abbrev", "--no-renames", "--diff-filter=AM")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRaw(out)
+}
+
+// parseRaw parses the -z output of git diff --raw: a ":srcmode dstmode src
+// dst status" record followed by the path, each terminated by NUL.
+func parseRaw(out []byte) ([]StagedFile, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("invalid raw diff %q", out)
+	}
+
+	files := make([]StagedFile, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		record := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(record) != 5 { //nolint: mnd // Modes, objects and status.
+			return nil, fmt.Errorf("invalid raw diff record %q", fields[i])
+		}
+		files = append(files, StagedFile{Path: fields[i+1], Mode: record[1], Object: record[3]})
+	}
+
+	return files, nil
+}
+
+// ReadBlob returns the content of a blob.
+func ReadBlob(ctx context.Context, root, object string) ([]byte, error) {
+	return run(ctx, root, "cat-file", "blob", object)
+}
+
+// WriteIndex stores content as a new blob and stages it in place of file.
+func WriteIndex(ctx context.Context, root string, file StagedFile, content []byte) error {
+	out, err := runInput(ctx, root, bytes.NewReader(content), "hash-object", "-w", "--no-filters", "--stdin")
+	if err != nil {
+		return err
+	}
+	object := strings.TrimSpace(string(out))
+
+	_, err = run(ctx, root, "update-index", "--cacheinfo", file.Mode+","+object+","+file.Path)
+
+	return err
+}
+
+func run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return runInput(ctx, dir, nil, args...)
+}
+
+func runInput(ctx context.Context, dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	// Unquoted paths keep non-ASCII file names intact in the diff.
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.quotePath=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("git %s: %w", args[0], err)
+		}
+
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+	}
+
+	return out, nil
+}
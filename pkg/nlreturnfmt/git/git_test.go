@@ -0,0 +1,140 @@
+package git_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/git"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3 @@ func a() {
+-	return
++	return nil
+@@ -10,0 +11,3 @@ func b() {
++	x := 1
++	_ = x
++	return
+@@ -20,2 +23,0 @@ func c() {
+-	x := 1
+-	_ = x
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+--- a/gone.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package gone
+diff --git "a/\303\251.go" "b/\303\251.go"
+--- "a/\303\251.go"
++++ "b/\303\251.go"
+@@ -7 +7,2 @@
++	return
+diff --git a/only_deleted.go b/only_deleted.go
+--- a/only_deleted.go
++++ b/only_deleted.go
+@@ -5 +4,0 @@
+-	_ = x
+`
+
+	// Git appends a tab to names containing spaces.
+	diff += "diff --git a/a b.go b/a b.go\n--- a/a b.go\t\n+++ b/a b.go\t\n@@ -2 +2 @@\n+\treturn\n"
+
+	got, err := git.ParseDiff("/repo", []byte(diff))
+	require.NoError(t, err)
+	assert.Equal(t, git.Changes{
+		filepath.FromSlash("/repo/a.go"):   {{Start: 3, End: 3}, {Start: 11, End: 13}},
+		filepath.FromSlash("/repo/a b.go"): {{Start: 2, End: 2}},
+		filepath.FromSlash("/repo/é.go"):   {{Start: 7, End: 8}},
+	}, got)
+	assert.Equal(t, []bytefmt.LineRange{}, got.Ranges(filepath.FromSlash("/repo/only_deleted.go")))
+}
+
+func TestDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q")
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n\nfunc a() {\n\treturn\n}\n")
+	writeFile(t, filepath.Join(dir, "b.go"), "package a\n")
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "initial")
+
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n\nfunc a() {\n\tx := 1\n\t_ = x\n\treturn\n}\n")
+
+	got, err := git.Diff(t.Context(), dir, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []bytefmt.LineRange{{Start: 4, End: 5}}, got.Ranges(filepath.Join(dir, "a.go")))
+	assert.Equal(t, []bytefmt.LineRange{}, got.Ranges(filepath.Join(dir, "b.go")))
+	assert.Len(t, got.Files(), 1)
+
+	_, err = git.Diff(t.Context(), dir, "no-such-ref")
+	require.Error(t, err)
+}
+
+func TestStaged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q")
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n")
+	writeFile(t, filepath.Join(dir, "b.go"), "package b\n")
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "initial")
+
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n\nvar staged int\n")
+	gitCmd(t, dir, "add", "a.go")
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n\nvar unstaged int\n")
+	writeFile(t, filepath.Join(dir, "b.go"), "package b\n\nvar unstaged int\n")
+
+	root, err := git.Root(t.Context(), dir)
+	require.NoError(t, err)
+
+	files, err := git.Staged(t.Context(), root)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "a.go", files[0].Path)
+	assert.Equal(t, "100644", files[0].Mode)
+
+	blob, err := git.ReadBlob(t.Context(), root, files[0].Object)
+	require.NoError(t, err)
+	assert.Equal(t, "package a\n\nvar staged int\n", string(blob))
+
+	require.NoError(t, git.WriteIndex(t.Context(), root, files[0], []byte("package a\n\nvar written int\n")))
+
+	files, err = git.Staged(t.Context(), root)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	blob, err = git.ReadBlob(t.Context(), root, files[0].Object)
+	require.NoError(t, err)
+	assert.Equal(t, "package a\n\nvar written int\n", string(blob))
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o600))
+}
@@ -0,0 +1,214 @@
+// Package mdfmt formats the Go code blocks of Markdown documents.
+package mdfmt
+
+import (
+	"bytes"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+)
+
+type (
+	// fence is a fenced Go code block.
+	fence struct {
+		start, end int // Offsets of the content, without the fence lines.
+		line       int // Line of the first content line.
+		indent     int // Indentation of the opening fence.
+	}
+	// fenceResult is a formatted fence content.
+	fenceResult struct {
+		value   []byte
+		changes []bytefmt.Change
+	}
+)
+
+// Format formats every ```go (or ~~~go) fence of a Markdown document with f,
+// leaving everything outside of the fences alone. A fence may hold a file, a
+// declaration list or a statement list, see bytefmt.Formatter.FormatFragment.
+// Fences that are none of these are left alone, since docs may contain pseudo
+// code.
+func Format(f *bytefmt.Formatter, filename string, src []byte) (bytefmt.Result, error) {
+	return FormatRange(f, filename, src, nil)
+}
+
+// FormatRange is like Format, but only applies changes positioned within the
+// given lines of the document, see bytefmt.Formatter.FormatRange.
+//
+// Changes of the result are positioned in the document. Their edits apply to
+// the fence contents, so they are dropped.
+func FormatRange(
+	f *bytefmt.Formatter, filename string, src []byte, ranges []bytefmt.LineRange,
+) (bytefmt.Result, error) {
+	var (
+		out     bytes.Buffer
+		changes []bytefmt.Change
+		last    int
+	)
+	for _, fc := range fences(src) {
+		res, ok := formatFence(f, filename, src, fc, ranges)
+		if !ok || len(res.changes) == 0 {
+			continue
+		}
+
+		out.Write(src[last:fc.start])
+		out.Write(res.value)
+		last = fc.end
+		changes = append(changes, res.changes...)
+	}
+
+	if len(changes) == 0 {
+		return bytefmt.Result{Filename: filename, Value: src}, nil
+	}
+	out.Write(src[last:])
+
+	return bytefmt.Result{
+		Filename: filename,
+		Value:    out.Bytes(),
+		Modified: true,
+		Details:  bytefmt.Describe(changes),
+		Changes:  changes,
+	}, nil
+}
+
+// formatFence reports false if the fence content is not Go code.
+func formatFence(
+	f *bytefmt.Formatter, filename string, src []byte, fc fence, ranges []bytefmt.LineRange,
+) (fenceResult, bool) {
+	content, indents := dedent(src[fc.start:fc.end], fc.indent)
+
+	offset := fc.line - 1
+	res, err := f.FormatFragment(filename, content, shift(ranges, offset))
+	if err != nil {
+		return fenceResult{}, false
+	}
+	if !res.Modified {
+		return fenceResult{}, true
+	}
+	changes := make([]bytefmt.Change, 0, len(res.Changes))
+	for _, c := range res.Changes {
+		c.Pos.Line += offset
+		c.Pos.Column += fc.indent
+		c.Pos.Offset = -1
+		c.Edits = nil
+		changes = append(changes, c)
+	}
+
+	return fenceResult{value: reindent(res.Value, indents), changes: changes}, true
+}
+
+// shift moves line ranges of the document by -offset lines into a fence.
+func shift(ranges []bytefmt.LineRange, offset int) []bytefmt.LineRange {
+	if ranges == nil {
+		return nil
+	}
+
+	shifted := make([]bytefmt.LineRange, 0, len(ranges))
+	for _, r := range ranges {
+		shifted = append(shifted, bytefmt.LineRange{Start: r.Start - offset, End: r.End - offset})
+	}
+
+	return shifted
+}
+
+// dedent removes up to indent leading spaces from every line, as Markdown
+// does for fences nested in lists. It returns the removed prefixes of the
+// non-blank lines.
+func dedent(content []byte, indent int) ([]byte, [][]byte) {
+	var (
+		out     []byte
+		indents [][]byte
+	)
+	for line := range bytes.Lines(content) {
+		n := 0
+		for n < indent && n < len(line) && line[n] == ' ' {
+			n++
+		}
+		if len(bytes.TrimSpace(line)) != 0 {
+			indents = append(indents, line[:n])
+		}
+		out = append(out, line[n:]...)
+	}
+
+	return out, indents
+}
+
+// reindent restores the prefixes removed by dedent. Formatting only inserts
+// and deletes blank lines, so the non-blank lines keep their order.
+func reindent(content []byte, indents [][]byte) []byte {
+	var out []byte
+	i := 0
+	for line := range bytes.Lines(content) {
+		if len(bytes.TrimSpace(line)) != 0 && i < len(indents) {
+			out = append(out, indents[i]...)
+			i++
+		}
+		out = append(out, line...)
+	}
+
+	return out
+}
+
+// fences returns the closed ```go and ~~~go fences of a Markdown document.
+// Fences of other languages are skipped along with their content.
+func fences(src []byte) []fence {
+	var (
+		result []fence
+		open   *fence
+		marker []byte // Opening fence marker, e.g. "```".
+		isGo   bool
+	)
+
+	offset, lineNo := 0, 0
+	for line := range bytes.Lines(src) {
+		lineNo++
+		lineStart := offset
+		offset += len(line)
+
+		indent, mark, info := fenceLine(line)
+		switch {
+		case open == nil && mark != nil:
+			// Backtick fences may not have backticks in the info string.
+			if mark[0] == '`' && bytes.ContainsRune(info, '`') {
+				continue
+			}
+			fields := bytes.Fields(info)
+			isGo = len(fields) != 0 && string(fields[0]) == "go"
+			marker = mark
+			open = &fence{start: offset, line: lineNo + 1, indent: indent}
+		case open != nil && mark != nil && mark[0] == marker[0] && len(mark) >= len(marker) && len(info) == 0:
+			if isGo {
+				open.end = lineStart
+				result = append(result, *open)
+			}
+			open = nil
+		}
+	}
+
+	return result
+}
+
+// fenceLine returns the indentation, marker and trimmed info string of a
+// fence line, or a nil marker for other lines. Any indentation is accepted,
+// so that fences nested in lists are found.
+func fenceLine(line []byte) (int, []byte, []byte) {
+	indent := 0
+	for indent < len(line) && line[indent] == ' ' {
+		indent++
+	}
+	if indent == len(line) {
+		return 0, nil, nil
+	}
+
+	c := line[indent]
+	if c != '`' && c != '~' {
+		return 0, nil, nil
+	}
+	n := indent
+	for n < len(line) && line[n] == c {
+		n++
+	}
+	if n-indent < 3 { //nolint: mnd // Minimal fence length.
+		return 0, nil, nil
+	}
+
+	return indent, line[indent:n], bytes.TrimSpace(line[n:])
+}
@@ -0,0 +1,111 @@
+package mdfmt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/mdfmt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	unformatted = "println()\nreturn\n"
+	formatted   = "println()\n\nreturn\n"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "backtick fence",
+			input: "```go\n" + unformatted + "```\n",
+			want:  "```go\n" + formatted + "```\n",
+		},
+		{
+			name:  "tilde fence",
+			input: "~~~go\n" + unformatted + "~~~\n",
+			want:  "~~~go\n" + formatted + "~~~\n",
+		},
+		{
+			name:  "tilde fence is not closed by backticks",
+			input: "~~~go\n" + unformatted + "```\n" + unformatted + "~~~\n",
+			want:  "~~~go\n" + unformatted + "```\n" + unformatted + "~~~\n",
+		},
+		{
+			name:  "longer fence",
+			input: "````go\n" + unformatted + "````\n",
+			want:  "````go\n" + formatted + "````\n",
+		},
+		{
+			name:  "longer fence is not closed by a shorter one",
+			input: "````text\n```go\n" + unformatted + "```\n````\n",
+			want:  "````text\n```go\n" + unformatted + "```\n````\n",
+		},
+		{
+			name:  "closing fence may be longer",
+			input: "```go\n" + unformatted + "`````\n",
+			want:  "```go\n" + formatted + "`````\n",
+		},
+		{
+			name:  "indented fence",
+			input: "1. item\n\n   ```go\n   println()\n   return\n   ```\n",
+			want:  "1. item\n\n   ```go\n   println()\n\n   return\n   ```\n",
+		},
+		{
+			name:  "indented fence with deeper content",
+			input: "  ```go\n  if x {\n  \tprintln()\n  \treturn\n  }\n  ```\n",
+			want:  "  ```go\n  if x {\n  \tprintln()\n\n  \treturn\n  }\n  ```\n",
+		},
+		{
+			name:  "unclosed fence",
+			input: "```go\n" + unformatted,
+			want:  "```go\n" + unformatted,
+		},
+		{
+			name:  "info string with attributes",
+			input: "```go title=\"main.go\"\n" + unformatted + "```\n",
+			want:  "```go title=\"main.go\"\n" + formatted + "```\n",
+		},
+		{
+			name:  "other info strings",
+			input: "```golang\n" + unformatted + "```\n```text\n" + unformatted + "```\n```\n" + unformatted + "```\n",
+			want:  "```golang\n" + unformatted + "```\n```text\n" + unformatted + "```\n```\n" + unformatted + "```\n",
+		},
+		{
+			name:  "CRLF line endings",
+			input: "# Title\r\n\r\n```go\r\nprintln()\r\nreturn\r\n```\r\n",
+			want:  "# Title\r\n\r\n```go\r\nprintln()\r\n\r\nreturn\r\n```\r\n",
+		},
+		{
+			name:  "invalid Go",
+			input: "```go\nfunc ... {\n\tprintln()\n\treturn\n}\n```\n",
+			want:  "```go\nfunc ... {\n\tprintln()\n\treturn\n}\n```\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mdfmt.Format(bytefmt.New(), "doc.md", []byte(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got.Value))
+			assert.Equal(t, tt.input != tt.want, got.Modified)
+		})
+	}
+}
+
+func TestFormat_Positions(t *testing.T) {
+	src := "# Title\n\nText.\n\n  ```go\n  println()\n  return\n  ```\n"
+
+	got, err := mdfmt.Format(bytefmt.New(), "doc.md", []byte(src))
+	require.NoError(t, err)
+	require.Len(t, got.Changes, 1)
+	assert.Equal(t, 7, got.Changes[0].Pos.Line)
+	assert.Equal(t, 3, got.Changes[0].Pos.Column)
+	assert.True(t, strings.HasPrefix(got.Details, "- insert blank line before return at doc.md:7:3"), got.Details)
+}
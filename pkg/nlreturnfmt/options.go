@@ -1,5 +1,10 @@
 package nlreturnfmt
 
+import (
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/baseline"
+	"github.com/dlomanov/nlreturnfmt/pkg/nlreturnfmt/bytefmt"
+)
+
 type Option func(*Formatter)
 
 func WithBlockSize(blockSize int) Option {
@@ -10,6 +15,52 @@ func WithBlockSize(blockSize int) Option {
 	}
 }
 
+// WithRules replaces the default rule set, which is bytefmt.NLReturn
+// configured by WithBlockSize. Rules are applied in order of precedence.
+func WithRules(rules ...bytefmt.Rule) Option {
+	return func(f *Formatter) { f.rules = append(f.rules, rules...) }
+}
+
+// WithShortFuncs exempts functions whose body spans at most size lines or
+// statements, see bytefmt.WithShortFuncs.
+func WithShortFuncs(size int, m bytefmt.Measure) Option {
+	return func(f *Formatter) { f.bytefmtOpts = append(f.bytefmtOpts, bytefmt.WithShortFuncs(size, m)) }
+}
+
+// WithLineRanges limits formatting of every file to the given line ranges.
+func WithLineRanges(ranges ...bytefmt.LineRange) Option {
+	return func(f *Formatter) {
+		f.lineRanges = func(string) []bytefmt.LineRange { return ranges }
+	}
+}
+
+// WithFileLineRanges limits formatting of each file to the line ranges
+// returned by fn, nil ranges format the whole file.
+func WithFileLineRanges(fn func(filename string) []bytefmt.LineRange) Option {
+	return func(f *Formatter) { f.lineRanges = fn }
+}
+
+// WithBaseline suppresses the violations recorded in b, so that only new
+// ones are reported and fixed.
+func WithBaseline(b *baseline.Baseline) Option {
+	return func(f *Formatter) {
+		f.baseline = b
+		f.bytefmtOpts = append(f.bytefmtOpts, bytefmt.WithFilter(b.Filter))
+	}
+}
+
+// WithBaselineUpdate records the violations of every file in b instead of
+// reporting or fixing them.
+func WithBaselineUpdate(b *baseline.Baseline) Option {
+	return func(f *Formatter) { f.record = b }
+}
+
+// WithMarkdown formats the Go code blocks of Markdown documents found in
+// directories too. Markdown files passed by name are always formatted.
+func WithMarkdown() Option {
+	return func(f *Formatter) { f.markdown = true }
+}
+
 func WithWrite() Option {
 	return func(f *Formatter) { f.write = true }
 }
@@ -29,3 +80,12 @@ func WithParallelism(n int) Option {
 		}
 	}
 }
+
+// WithCache skips files recorded as formatted in the cache stored in dir,
+// and records formatted files there. The version must identify the tool build.
+func WithCache(dir, version string) Option {
+	return func(f *Formatter) {
+		f.cacheDir = dir
+		f.cacheVersion = version
+	}
+}
@@ -0,0 +1,58 @@
+package blockend
+
+import "errors"
+
+func ifBlock(v int) int {
+	if v > 0 {
+		v++
+	}
+	v--
+	if v > 10 {
+		v = 10
+	} else {
+		v = 0
+	}
+	println(v)
+	if v < 0 { v = 0 }
+	println(v)
+
+	return v
+}
+
+func loops(vs []int) int {
+	n := 0
+	for _, v := range vs {
+		n += v
+	}
+	for i := 0; i < n; i++ {
+		if i > 10 {
+			n--
+		}
+	}
+	println(n)
+	// A comment keeps the statement separated already.
+	for n > 0 {
+		n--
+	}
+	switch n {
+	case 0:
+		n++
+	}
+	select {}
+}
+
+func errChain() error {
+	err := errors.New("first")
+	if err != nil {
+		return err
+	}
+	err = errors.New("second")
+	if err != nil {
+		return err
+	}
+	var parseErr error
+	if parseErr != nil {
+		return parseErr
+	}
+	return nil
+}
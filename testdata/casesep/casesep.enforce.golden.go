@@ -0,0 +1,34 @@
+package casesep
+
+func switches(v any, ch chan int) {
+	switch v {
+	case 0:
+		println(v)
+		println(v)
+
+	case 1:
+		println(v)
+
+	case 2:
+		println(v)
+
+	default:
+	}
+
+	switch v.(type) {
+	case int:
+		println(v)
+		println(v)
+	// A comment keeps the clauses separated.
+	case string:
+	}
+
+	select {
+	case <-ch:
+		println(v)
+		println(v)
+
+	default:
+		println(v)
+	}
+}
@@ -0,0 +1,13 @@
+package crlf
+
+func f() int {
+	println()
+	return 1
+}
+
+func g() {
+	for {
+		println()
+		break
+	}
+}
@@ -0,0 +1,52 @@
+package cuddle
+
+type result struct{ v int }
+
+func do() error { return nil }
+
+func compute() int { return 1 }
+
+func assignedError() error {
+	println()
+	err := do()
+	return err
+}
+
+func assignedValue() (int, error) {
+	println()
+	v := compute()
+	return v, nil
+}
+
+func declared() int {
+	println()
+	var v = compute()
+	return v
+}
+
+func selector() int {
+	println()
+	r := result{v: compute()}
+	return r.v
+}
+
+func unrelated() int {
+	v := compute()
+	w := compute()
+	return v
+}
+
+func fieldNameOnly(r result) int {
+	println()
+	v := compute()
+	return r.v
+}
+
+func multiLine() int {
+	println()
+	v := max(
+		compute(),
+		compute(),
+	)
+	return v
+}
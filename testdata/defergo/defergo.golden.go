@@ -0,0 +1,38 @@
+package defergo
+
+import (
+	"os"
+	"sync"
+)
+
+func deferred(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	defer println("closed")
+
+	return nil
+}
+
+func first() {
+	defer println("first statement")
+	println()
+}
+
+func goroutines(wg *sync.WaitGroup) {
+	wg.Add(2)
+
+	go wg.Done()
+	go wg.Done()
+
+	defer wg.Wait()
+}
+
+func withComment() {
+	println()
+	// The comment separates the defer already.
+	defer println()
+}
@@ -0,0 +1,22 @@
+package funclit
+
+import "sort"
+
+func sorted(vs []int) []int {
+	sort.Slice(vs, func(i, j int) bool {
+		a, b := vs[i], vs[j]
+		return a < b
+	})
+	vs = append(vs, 0)
+
+	return vs
+}
+
+func nested() func() int {
+	return func() int {
+		x := 1
+		x++
+
+		return x
+	}
+}
@@ -0,0 +1,25 @@
+package kinds
+
+func kinds(v []int) int {
+	i := 0
+Loop:
+	for _, x := range v {
+		switch x {
+		case 0:
+			i++
+
+			fallthrough
+		case 1:
+			i++
+			break
+		case 2:
+			i++
+			continue
+		case 3:
+			i++
+			goto Loop
+		}
+	}
+	i++
+	return i
+}
@@ -0,0 +1,50 @@
+package labels
+
+func labeledReturn(v int) int {
+	if v > 0 {
+		v++
+
+		goto done
+	}
+	v--
+
+done:
+	return v
+}
+
+func labeledOnSameLine(v int) int {
+	v++
+	v--
+
+done: return v
+}
+
+func labelAlone(v int) int {
+	if v > 0 {
+	done:
+		return v
+	}
+
+	return 0
+}
+
+func labeledLoop(m [][]int) int {
+	n := 0
+outer:
+	for _, row := range m {
+		for _, v := range row {
+			n += v
+			if n > 10 {
+				n = 10
+
+				break outer
+			}
+			n++
+
+			continue outer
+		}
+	}
+	n++
+
+	return n
+}
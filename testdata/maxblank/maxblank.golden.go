@@ -0,0 +1,34 @@
+package maxblank
+
+
+
+var keep = 1 // Blank lines outside of function bodies are left to gofmt.
+
+func pasted() int {
+	x := 1
+
+	x++
+
+	return x
+}
+
+func closure() func() string {
+	return func() string {
+		s := `keep
+
+
+blank lines in raw strings`
+
+		/* And in
+
+		   comments. */
+		return s
+	}
+}
+
+func beforeReturn() int {
+	x := 1
+	x++
+
+	return x
+}
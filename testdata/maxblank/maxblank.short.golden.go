@@ -0,0 +1,30 @@
+package maxblank
+
+func short() int {
+	x := 1
+
+
+	return x
+}
+
+func long() int {
+	x := 1
+
+	x++
+	x++
+	x++
+	return x
+}
+
+func nested() func() int {
+	x := 1
+
+	x++
+	x++
+	return func() int {
+		y := x
+
+
+		return y
+	}
+}
@@ -0,0 +1,26 @@
+package measure
+
+type point struct{ x, y int }
+
+func compositeLiteral() point {
+	p := point{
+		x: 1,
+		y: 2,
+	}
+	return p
+}
+
+func multiLineCall() int {
+	n := max(
+		1,
+		2,
+	)
+	return n
+}
+
+func twoStatements() int {
+	n := 1
+	n++
+
+	return n
+}
@@ -0,0 +1,24 @@
+package main
+
+func inside() int {
+	a := 1
+	_ = a
+
+	return a
+}
+
+func outside() int {
+	a := 1
+	_ = a
+	return a
+}
+
+func partial(v []int) int {
+	for range v {
+		_ = v
+		continue
+	}
+	_ = v
+
+	return 0
+}
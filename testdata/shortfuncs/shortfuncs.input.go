@@ -0,0 +1,32 @@
+package shortfuncs
+
+type counter struct{ n int }
+
+func (c *counter) get() int {
+	n := c.n
+	return n
+}
+
+func (c *counter) next() int {
+	c.n++
+	n := c.n
+	c.n++
+	return n
+}
+
+func callbacks(f func() error) error {
+	err := f()
+	if err != nil {
+		return err
+	}
+	return callbacks(func() error { x := f(); return x })
+}
+
+func longClosure() func() int {
+	return func() int {
+		x := 1
+		x++
+		x++
+		return x
+	}
+}
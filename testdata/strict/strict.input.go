@@ -0,0 +1,57 @@
+package strict
+
+func alone(err error) error {
+	if err != nil {
+
+		return err
+	}
+
+	return nil
+}
+
+func short() int {
+	x := 1
+
+	return x
+}
+
+func collapse() int {
+	x := 1
+	x++
+
+
+
+	return x
+}
+
+func withComment(err error) error {
+	if err != nil {
+		// The comment keeps the blank line above.
+
+		return err
+	}
+
+	return nil
+}
+
+func insert() int {
+	x := 1
+	x++
+	return x
+}
+
+func caseClause(v int) int {
+	switch v {
+	case 0:
+
+		return 0
+	case 1:
+		v++
+		v++
+
+
+		break
+	}
+
+	return v
+}
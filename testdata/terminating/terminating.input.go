@@ -0,0 +1,44 @@
+package terminating
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+func withPanic(v int) {
+	if v < 0 {
+		v++
+		panic("negative")
+	}
+	println(v)
+	os.Exit(v)
+}
+
+func withLog(v int) {
+	if v > 0 {
+		println(v)
+		log.Fatalf("positive: %d", v)
+	}
+	println(v)
+	log.Println(v) // Not a terminating call.
+}
+
+func TestSkip(t *testing.T) {
+	v := 1
+	if v > 0 {
+		t.Log(v)
+		t.Skip("positive")
+	}
+	t.Log(v)
+	t.Fatal("unreachable")
+}
+
+func withCustom(v int) {
+	println(v)
+	mylog.Die(v) // Configured by the user.
+}
+
+func alone() {
+	panic("alone")
+}
@@ -0,0 +1,50 @@
+package trim
+
+func leading() int {
+	x := 1
+
+	return x
+}
+
+func trailing(v int) int {
+	if v > 0 {
+		v++
+	}
+
+	return v
+}
+
+func empty() {
+}
+
+func loop(vs []int) {
+	for _, v := range vs {
+		println(v)
+	}
+}
+
+func cases(v int) {
+	switch v {
+	case 0:
+		println(v)
+
+	case 1:
+		// A comment keeps the blank line below.
+
+		println(v)
+	}
+}
+
+func keepRawString() string {
+	s := `
+
+`
+
+	return s
+}
+
+func closure() func() {
+	return func() {
+		println()
+	}
+}
@@ -0,0 +1,9 @@
+package unformatted
+
+// Only blank lines are changed: the layout is not normalized like gofmt does,
+// and statements sharing a line with the previous one are left alone.
+func inc(x int) int {
+	if x>0 { x++; return x }
+	x  =  x-1
+	return x
+}